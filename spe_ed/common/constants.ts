@@ -15,6 +15,7 @@
  * limitations under the License.
  */
 const cellColors = {
+  "-2": "#4a4a57", // Obstacle
   "-1": "#000000", // Collision
   "0": "#efeff6", // Background
   "1": "#f52e2e",
@@ -22,7 +23,17 @@ const cellColors = {
   "3": "#ffc717",
   "4": "#1f9e40",
   "5": "#ff6619",
-  "6": "#24d4c4"
+  "6": "#24d4c4",
+  "7": "#a83ec9",
+  "8": "#8c5a2b",
+  "9": "#ff8fc8",
+  "10": "#7a7a7a",
+  "11": "#9ccc2e",
+  "12": "#0b5e75",
+  "13": "#b8860b",
+  "14": "#6b1f2a",
+  "15": "#3d2fa8",
+  "16": "#2e8b57"
 };
 
 export { cellColors };
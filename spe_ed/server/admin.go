@@ -0,0 +1,132 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	golog "log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var (
+	adminToken string
+	auditLog   *golog.Logger
+)
+
+// InitAdmin reads the admin token from a file and opens the audit log. Every admin request is written to the audit log.
+// The token file must contain a single token, surrounding whitespace is ignored.
+func InitAdmin(tokenFile, auditFile string) {
+	b, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		panic(err)
+	}
+	adminToken = strings.TrimSpace(string(b))
+	if adminToken == "" {
+		panic("admin token must not be empty")
+	}
+
+	f, err := os.OpenFile(auditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		panic(err)
+	}
+	auditLog = golog.New(f, "", golog.LstdFlags)
+}
+
+// adminEndpoint serves the admin API. All requests must contain the header "Authorization: Bearer <admin token>".
+// Parameters must be sent form encoded in the request body, keys in the URL are rejected so they do not end up in access logs.
+//
+// GET  /spe_ed_admin/keys          lists all keys with their claim state
+// POST /spe_ed_admin/keys/add      adds the key given by parameter "key", only a salted hash is stored if parameter "hash" is "true"
+// POST /spe_ed_admin/keys/revoke   revokes the key given by parameter "key" and closes its live connections
+// POST /spe_ed_admin/keys/release  releases all claims of the key given by parameter "key"
+func adminEndpoint(rw http.ResponseWriter, r *http.Request) {
+	action := strings.TrimPrefix(r.URL.Path, "/spe_ed_admin/")
+
+	// Authenticate before the request body is parsed
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+		auditLog.Println("denied", r.RemoteAddr, r.Method, action)
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if _, ok := r.URL.Query()["key"]; ok {
+		auditLog.Println("failed", r.RemoteAddr, action, "- key in URL")
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte("key must be sent in the request body"))
+		return
+	}
+	key := r.PostFormValue("key")
+
+	// Plain keys are never logged, key file entries (e.g. salted hashes) are safe to log
+	logKey := key
+	if !strings.HasPrefix(key, KeyHashPrefix) {
+		logKey = KeyFingerprint(key)
+	}
+
+	if action == "keys" {
+		if r.Method != http.MethodGet {
+			rw.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		auditLog.Println("ok", r.RemoteAddr, "list keys")
+		b, err := json.Marshal(ListKeys())
+		if err != nil {
+			log.Println("admin:", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+		rw.Write(b)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var err error
+	switch action {
+	case "keys/add":
+		err = AddKey(key, r.PostFormValue("hash") == "true")
+	case "keys/revoke":
+		err = RevokeKey(key)
+	case "keys/release":
+		if !ForceReleaseKey(key) {
+			err = ErrKeyNotFound
+		}
+	default:
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		auditLog.Println("failed", r.RemoteAddr, action, logKey, "-", err)
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte(err.Error()))
+		return
+	}
+	auditLog.Println("ok", r.RemoteAddr, action, logKey)
+	log.Println("admin:", action, logKey)
+	rw.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	golog "log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// useAdmin sets the admin token and a key file containing the keys for a test. The audit log is returned.
+func useAdmin(t *testing.T, token string, keys ...string) *bytes.Buffer {
+	t.Helper()
+	useKeys(t, keys...)
+	oldToken, oldAudit, oldFile := adminToken, auditLog, keyFileName
+	t.Cleanup(func() { adminToken, auditLog, keyFileName = oldToken, oldAudit, oldFile })
+
+	var audit bytes.Buffer
+	adminToken = token
+	auditLog = golog.New(&audit, "", 0)
+	keyFileName = tempFile(t, "keys", strings.Join(keys, "\n")+"\n")
+	return &audit
+}
+
+// adminRequest sends a request to the admin API and returns the status and body of the response.
+func adminRequest(token, method, target string, form url.Values) (int, string) {
+	r := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	rw := httptest.NewRecorder()
+	adminEndpoint(rw, r)
+	body, _ := ioutil.ReadAll(rw.Result().Body)
+	return rw.Code, string(body)
+}
+
+func TestAdminAuthentication(t *testing.T) {
+	audit := useAdmin(t, "admin-token", "a")
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"wrong token", "admin", http.StatusUnauthorized},
+		{"key as token", "a", http.StatusUnauthorized},
+		{"valid token", "admin-token", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _ := adminRequest(tt.token, http.MethodGet, "/spe_ed_admin/keys", nil)
+			if status != tt.status {
+				t.Errorf("got status %d, want %d", status, tt.status)
+			}
+		})
+	}
+	if !strings.Contains(audit.String(), "denied") {
+		t.Errorf("denied requests not in audit log: %q", audit.String())
+	}
+}
+
+func TestAdminKeys(t *testing.T) {
+	audit := useAdmin(t, "admin-token", "a", "b")
+	claimStatus("a")
+
+	status, body := adminRequest("admin-token", http.MethodGet, "/spe_ed_admin/keys", nil)
+	if status != http.StatusOK {
+		t.Fatalf("list: got status %d (%s)", status, body)
+	}
+	var list []KeyState
+	err := json.Unmarshal([]byte(body), &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Key != "a" || list[0].InUse != 1 || list[1].InUse != 0 {
+		t.Errorf("got key list %+v", list)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		action string
+		form   url.Values
+		status int
+	}{
+		{"add", http.MethodPost, "keys/add", url.Values{"key": {"c"}}, http.StatusOK},
+		{"add hashed", http.MethodPost, "keys/add", url.Values{"key": {"d"}, "hash": {"true"}}, http.StatusOK},
+		{"add existing", http.MethodPost, "keys/add", url.Values{"key": {"a"}}, http.StatusBadRequest},
+		{"add hash entry", http.MethodPost, "keys/add", url.Values{"key": {KeyHashPrefix + "00:00"}}, http.StatusBadRequest},
+		{"release", http.MethodPost, "keys/release", url.Values{"key": {"a"}}, http.StatusOK},
+		{"release unknown", http.MethodPost, "keys/release", url.Values{"key": {"x"}}, http.StatusBadRequest},
+		{"revoke", http.MethodPost, "keys/revoke", url.Values{"key": {"b"}}, http.StatusOK},
+		{"revoke unknown", http.MethodPost, "keys/revoke", url.Values{"key": {"b"}}, http.StatusBadRequest},
+		{"get", http.MethodGet, "keys/add", url.Values{"key": {"e"}}, http.StatusMethodNotAllowed},
+		{"unknown action", http.MethodPost, "keys/rename", url.Values{"key": {"a"}}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := adminRequest("admin-token", tt.method, "/spe_ed_admin/"+tt.action, tt.form)
+			if status != tt.status {
+				t.Errorf("got status %d (%s), want %d", status, body, tt.status)
+			}
+		})
+	}
+
+	for key, valid := range map[string]bool{"a": true, "b": false, "c": true, "d": true, "e": false} {
+		if IsValidKey(key) != valid {
+			t.Errorf("key %s: got valid %t, want %t", key, !valid, valid)
+		}
+	}
+	if claimStatus("a") != KeyOK {
+		t.Error("released key can not be claimed")
+	}
+	b, err := ioutil.ReadFile(keyFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(b), "\n")
+	for _, l := range lines {
+		if l == "d" {
+			t.Error("hashed key stored in plain text")
+		}
+	}
+	if !strings.Contains(string(b), KeyHashPrefix) {
+		t.Errorf("no hash in key file: %q", b)
+	}
+	for _, key := range []string{"\na\n", " c\n", " d\n"} {
+		if strings.Contains(audit.String(), key) {
+			t.Errorf("audit log contains plain key %q", key)
+		}
+	}
+}
+
+func TestAdminKeyInURL(t *testing.T) {
+	audit := useAdmin(t, "admin-token", "a")
+	status, _ := adminRequest("admin-token", http.MethodPost, "/spe_ed_admin/keys/add?key=b", nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("got status %d, want %d", status, http.StatusBadRequest)
+	}
+	status, _ = adminRequest("admin-token", http.MethodPost, "/spe_ed_admin/keys/revoke?key=a", url.Values{"key": {"a"}})
+	if status != http.StatusBadRequest {
+		t.Errorf("key in body and URL: got status %d, want %d", status, http.StatusBadRequest)
+	}
+	if IsValidKey("b") || !IsValidKey("a") {
+		t.Error("keys changed by request with key in URL")
+	}
+	if strings.Contains(audit.String(), "key=") {
+		t.Errorf("audit log contains URL parameters: %q", audit.String())
+	}
+}
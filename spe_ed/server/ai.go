@@ -96,9 +96,13 @@ var aiArray = []func() (AI, string){
 //
 // In GetState, AIs can only access public fields (and change them) plus stepCounter, privat fields are set to zero.
 // Modification of the game is allowed. The Caller has to make sure that modifications to the provided game can be done without side effects (e.g. by using Game.PublicCopy )
+//
+// All randomness of an AI must be derived from the seed given in SetSeed so games can be reproduced.
+// SetSeed is called before the first call to GetState. AIs without a seed must still work (e.g. by choosing a random seed).
 type AI interface {
 	GetChannel(c chan string)
 	GetState(g *Game)
+	SetSeed(seed int64)
 	Name() string
 }
 
@@ -154,6 +158,13 @@ func UpdateAIPool(ais []string) error {
 	return nil
 }
 
+// AIPoolSize returns the number of AIs in the current rotation.
+func AIPoolSize() int {
+	aiLock.RLock()
+	defer aiLock.RUnlock()
+	return len(aiArray)
+}
+
 // GetAINames returns a list of all known ais in alphabetical order.
 func GetAINames() []string {
 	aiLock.RLock()
@@ -166,9 +177,31 @@ func GetAINames() []string {
 	return s
 }
 
+// GetNamedAI returns new AIs with the given names (as registered with RegisterAI).
+// All random decisions (including the seeds of the AIs) are taken from r.
+func GetNamedAI(names []string, r *rand.Rand) ([]NewAI, error) {
+	aiLock.RLock()
+	defer aiLock.RUnlock()
+
+	counter := make(map[string]int, len(names))
+	ais := make([]NewAI, len(names))
+	for i := range names {
+		f, ok := aiMap[names[i]]
+		if !ok {
+			return nil, fmt.Errorf("ai name %s not known", names[i])
+		}
+		counter[names[i]]++
+		ais[i].AI = f()
+		ais[i].API = GlobalPseudonym.Get(fmt.Sprintf("AI-%s-%d", names[i], counter[names[i]]))
+		ais[i].AI.SetSeed(r.Int63())
+	}
+	return ais, nil
+}
+
 // GetAI returns a slice of AIs of specified number out of the current rotation.
-// Function might panic if number is to large. This should only occur if the number is larger than 6.
-func GetAI(num int) []NewAI {
+// All random decisions (including the seeds of the AIs) are taken from r.
+// Function might panic if number is to large. This should only occur if the number is larger than AIPoolSize.
+func GetAI(num int, r *rand.Rand) []NewAI {
 	aiLock.RLock()
 	defer aiLock.RUnlock()
 
@@ -176,16 +209,17 @@ func GetAI(num int) []NewAI {
 		panic("Not enough AI")
 	}
 
-	r := make([]NewAI, num)
 	selectArray := make([]int, len(aiArray))
 	for i := range selectArray {
 		selectArray[i] = i
 	}
-	rand.Shuffle(len(selectArray), func(i, j int) { selectArray[i], selectArray[j] = selectArray[j], selectArray[i] })
+	r.Shuffle(len(selectArray), func(i, j int) { selectArray[i], selectArray[j] = selectArray[j], selectArray[i] })
 
-	for i := range r {
-		r[i].AI, r[i].API = aiArray[selectArray[i]]()
+	ais := make([]NewAI, num)
+	for i := range ais {
+		ais[i].AI, ais[i].API = aiArray[selectArray[i]]()
+		ais[i].AI.SetSeed(r.Int63())
 	}
 
-	return r
+	return ais
 }
@@ -31,6 +31,7 @@ func init() {
 type BadRandomAI struct {
 	l sync.Mutex
 	i chan string
+	r *rand.Rand
 }
 
 // GetChannel receives the answer channel.
@@ -40,6 +41,14 @@ func (r *BadRandomAI) GetChannel(c chan string) {
 	r.i = c
 }
 
+// SetSeed sets the seed of the random number generator used by the AI.
+func (r *BadRandomAI) SetSeed(seed int64) {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	r.r = rand.New(rand.NewSource(seed))
+}
+
 // GetState gets the game state and computes an answer.
 func (r *BadRandomAI) GetState(g *Game) {
 	r.l.Lock()
@@ -49,53 +58,22 @@ func (r *BadRandomAI) GetState(g *Game) {
 		return
 	}
 
+	if r.r == nil {
+		r.r = rand.New(rand.NewSource(rand.Int63()))
+	}
+
 	if g.Running {
 		// actions
 		actions := []string{ActionTurnLeft, ActionTurnRight, ActionSlower, ActionFaster, ActionNOOP}
-		rand.Shuffle(len(actions), func(i, j int) { actions[i], actions[j] = actions[j], actions[i] })
+		r.r.Shuffle(len(actions), func(i, j int) { actions[i], actions[j] = actions[j], actions[i] })
 
 		// test actions
 		for i := range actions {
 			// do action
-			switch actions[i] {
-			case ActionTurnLeft:
-				switch g.Players[g.You].Direction {
-				case DirectionLeft:
-					g.Players[g.You].Direction = DirectionDown
-				case DirectionRight:
-					g.Players[g.You].Direction = DirectionUp
-				case DirectionUp:
-					g.Players[g.You].Direction = DirectionLeft
-				case DirectionDown:
-					g.Players[g.You].Direction = DirectionRight
-				}
-			case ActionTurnRight:
-				switch g.Players[g.You].Direction {
-				case DirectionLeft:
-					g.Players[g.You].Direction = DirectionUp
-				case DirectionRight:
-					g.Players[g.You].Direction = DirectionDown
-				case DirectionUp:
-					g.Players[g.You].Direction = DirectionRight
-				case DirectionDown:
-					g.Players[g.You].Direction = DirectionLeft
-				}
-			case ActionFaster:
-				g.Players[g.You].Speed++
-				if g.Players[g.You].Speed > MaxSpeed {
-					g.Players[g.You].Speed--
-					continue
-				}
-			case ActionSlower:
-				g.Players[g.You].Speed--
-				if g.Players[g.You].Speed < 1 {
-					g.Players[g.You].Speed++
-					continue
-				}
-			case ActionNOOP:
-				// Do nothing
-			default:
-				log.Println("bad random ai:", "unknown action", actions[i])
+			direction, speed := g.Players[g.You].Direction, g.Players[g.You].Speed
+			if !ApplyAction(g, g.Players[g.You], actions[i]) {
+				g.Players[g.You].Direction, g.Players[g.You].Speed = direction, speed
+				continue
 			}
 
 			// test
@@ -108,36 +86,7 @@ func (r *BadRandomAI) GetState(g *Game) {
 			}
 
 			// undo action
-			switch actions[i] {
-			case ActionTurnLeft:
-				switch g.Players[g.You].Direction {
-				case DirectionLeft:
-					g.Players[g.You].Direction = DirectionUp
-				case DirectionRight:
-					g.Players[g.You].Direction = DirectionDown
-				case DirectionUp:
-					g.Players[g.You].Direction = DirectionRight
-				case DirectionDown:
-					g.Players[g.You].Direction = DirectionLeft
-				}
-			case ActionTurnRight:
-				switch g.Players[g.You].Direction {
-				case DirectionLeft:
-					g.Players[g.You].Direction = DirectionDown
-				case DirectionRight:
-					g.Players[g.You].Direction = DirectionUp
-				case DirectionUp:
-					g.Players[g.You].Direction = DirectionLeft
-				case DirectionDown:
-					g.Players[g.You].Direction = DirectionRight
-				}
-			case ActionFaster:
-				g.Players[g.You].Speed--
-			case ActionSlower:
-				g.Players[g.You].Speed++
-			case ActionNOOP:
-				// Do nothing
-			}
+			g.Players[g.You].Direction, g.Players[g.You].Speed = direction, speed
 		}
 
 		// no valid actions - pick random
@@ -152,37 +101,15 @@ func (r *BadRandomAI) GetState(g *Game) {
 // willCrash computes whether the given game state will result in a (possible) crash.
 // Not safe for concurrent use on the same game.
 func (r *BadRandomAI) willCrash(g *Game) bool {
-	oldX, oldY := g.Players[g.You].X, g.Players[g.You].Y
+	p := g.Players[g.You]
+	oldX, oldY, oldStepCounter := p.X, p.Y, p.stepCounter
 	defer func() {
-		g.Players[g.You].X, g.Players[g.You].Y = oldX, oldY
+		p.X, p.Y, p.stepCounter = oldX, oldY, oldStepCounter
 	}()
 
-	var dostep func(x, y int) (int, int)
-	switch g.Players[g.You].Direction {
-	case DirectionUp:
-		dostep = func(x, y int) (int, int) { return x, y - 1 }
-	case DirectionDown:
-		dostep = func(x, y int) (int, int) { return x, y + 1 }
-	case DirectionLeft:
-		dostep = func(x, y int) (int, int) { return x - 1, y }
-	case DirectionRight:
-		dostep = func(x, y int) (int, int) { return x + 1, y }
-	}
-
-	for s := 0; s < g.Players[g.You].Speed; s++ {
-		g.Players[g.You].X, g.Players[g.You].Y = dostep(g.Players[g.You].X, g.Players[g.You].Y)
-		if g.Players[g.You].X < 0 || g.Players[g.You].X >= g.Width || g.Players[g.You].Y < 0 || g.Players[g.You].Y >= g.Height {
-			return true
-		}
-		if g.Players[g.You].Speed >= HoleSpeed && (g.Players[g.You].stepCounter+1)%HolesEachStep == 0 && s != 0 && s != g.Players[g.You].Speed-1 {
-			continue
-		}
-		if g.Cells[g.Players[g.You].Y][g.Players[g.You].X] != 0 {
-			return true
-		}
-	}
-
-	return false
+	return !Advance(g, p, func(x, y int, hole bool) bool {
+		return hole || g.Cells[y][x] == 0
+	})
 }
 
 // Name returns the name of the AI.
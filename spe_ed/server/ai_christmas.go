@@ -42,6 +42,7 @@ type ChristmasAI struct {
 	i        chan string
 	counter  int
 	selected string
+	r        *rand.Rand
 }
 
 // GetChannel receives the answer channel.
@@ -52,6 +53,14 @@ func (c *ChristmasAI) GetChannel(ch chan string) {
 	c.i = ch
 }
 
+// SetSeed sets the seed of the random number generator used by the AI.
+func (c *ChristmasAI) SetSeed(seed int64) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	c.r = rand.New(rand.NewSource(seed))
+}
+
 // GetState gets the game state and computes an answer.
 func (c *ChristmasAI) GetState(g *Game) {
 	c.l.Lock()
@@ -61,8 +70,12 @@ func (c *ChristmasAI) GetState(g *Game) {
 		return
 	}
 
+	if c.r == nil {
+		c.r = rand.New(rand.NewSource(rand.Int63()))
+	}
+
 	if c.selected == "" {
-		c.selected = ChristmasAIActions[rand.Intn(len(ChristmasAIActions))]
+		c.selected = ChristmasAIActions[c.r.Intn(len(ChristmasAIActions))]
 	}
 
 	if g.Running {
@@ -39,6 +39,9 @@ func (er *EndRound) GetChannel(c chan string) {
 	er.i = c
 }
 
+// SetSeed is part of the AI interface. EndRound does not use randomness.
+func (er *EndRound) SetSeed(seed int64) {}
+
 // GetState gets the game state and computes an answer.
 func (er *EndRound) GetState(g *Game) {
 	er.l.Lock()
@@ -43,6 +43,9 @@ func (h *HeartAI) GetChannel(c chan string) {
 	h.i = c
 }
 
+// SetSeed is part of the AI interface. HeartAI does not use randomness.
+func (h *HeartAI) SetSeed(seed int64) {}
+
 // GetState gets the game state and computes an answer.
 func (h *HeartAI) GetState(g *Game) {
 	h.l.Lock()
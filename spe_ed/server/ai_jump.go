@@ -61,6 +61,14 @@ func (j *JumpAI) GetChannel(c chan string) {
 	j.i = c
 }
 
+// SetSeed sets the seed of the random number generator used by the AI.
+func (j *JumpAI) SetSeed(seed int64) {
+	j.l.Lock()
+	defer j.l.Unlock()
+
+	j.r = rand.New(rand.NewSource(seed))
+}
+
 // GetState gets the game state and computes an answer.
 func (j *JumpAI) GetState(g *Game) {
 	j.l.Lock()
@@ -70,6 +78,10 @@ func (j *JumpAI) GetState(g *Game) {
 		return
 	}
 
+	if j.r == nil {
+		j.r = rand.New(rand.NewSource(rand.Int63()))
+	}
+
 	if g.Running && g.Players[g.You].Active {
 		// Fill potential dead zones
 		for k := range g.Players {
@@ -83,6 +95,7 @@ func (j *JumpAI) GetState(g *Game) {
 
 			for i := 1; i <= g.Players[k].Speed+1; i++ {
 				x, y := g.Players[k].X+i, g.Players[k].Y
+				x, y = Wrap(g, x, y)
 				if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
 					// invalid - do nothing
 				} else {
@@ -90,6 +103,7 @@ func (j *JumpAI) GetState(g *Game) {
 				}
 
 				x, y = g.Players[k].X-i, g.Players[k].Y
+				x, y = Wrap(g, x, y)
 				if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
 					// invalid - do nothing
 				} else {
@@ -97,6 +111,7 @@ func (j *JumpAI) GetState(g *Game) {
 				}
 
 				x, y = g.Players[k].X, g.Players[k].Y+i
+				x, y = Wrap(g, x, y)
 				if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
 					// invalid - do nothing
 				} else {
@@ -104,6 +119,7 @@ func (j *JumpAI) GetState(g *Game) {
 				}
 
 				x, y = g.Players[k].X, g.Players[k].Y-i
+				x, y = Wrap(g, x, y)
 				if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
 					// invalid - do nothing
 				} else {
@@ -119,11 +135,7 @@ func (j *JumpAI) GetState(g *Game) {
 		}
 
 		if len(j.plan) == 0 {
-			if j.r == nil {
-				j.r = rand.New(rand.NewSource(rand.Int63()))
-			}
-
-			length := HolesEachStep - (g.Players[g.You].stepCounter % HolesEachStep)
+			length := g.Rules.HolesEachStep - (g.Players[g.You].stepCounter % g.Rules.HolesEachStep)
 
 			// Try finding jump
 			j.plan = j.findPlan(length, g.PublicCopy())
@@ -132,6 +144,7 @@ func (j *JumpAI) GetState(g *Game) {
 				// Try finding 1 step - reuse RandomAI
 				c := make(chan string, 1)
 				ai := RandomAI{}
+				ai.SetSeed(j.r.Int63())
 				ai.GetChannel(c)
 				ai.GetState(g)
 				j.plan = []string{<-c}
@@ -194,78 +207,29 @@ func (j *JumpAI) progress(g *Game, player int, command string) (int, jumpAIRever
 		Direction:   p.Direction,
 		Cells:       make([]struct{ X, Y int }, 0, p.Speed),
 	}
-	jump := false
-	switch command {
-	case ActionTurnLeft:
-		switch p.Direction {
-		case DirectionLeft:
-			p.Direction = DirectionDown
-		case DirectionRight:
-			p.Direction = DirectionUp
-		case DirectionUp:
-			p.Direction = DirectionLeft
-		case DirectionDown:
-			p.Direction = DirectionRight
-		}
-	case ActionTurnRight:
-		switch p.Direction {
-		case DirectionLeft:
-			p.Direction = DirectionUp
-		case DirectionRight:
-			p.Direction = DirectionDown
-		case DirectionUp:
-			p.Direction = DirectionRight
-		case DirectionDown:
-			p.Direction = DirectionLeft
-		}
-	case ActionFaster:
-		p.Speed++
-		if p.Speed > MaxSpeed {
-			return jumpAIprogressCrash, r
-		}
-	case ActionSlower:
-		p.Speed--
-		if p.Speed < 1 {
-			return jumpAIprogressCrash, r
-		}
-	case ActionNOOP:
-		// Do nothing
-	default:
-		log.Println("jump ai:", "unknown action", command)
+	if !ApplyAction(g, p, command) {
+		return jumpAIprogressCrash, r
 	}
 
-	var dostep func(x, y int) (int, int)
-	switch p.Direction {
-	case DirectionUp:
-		dostep = func(x, y int) (int, int) { return x, y - 1 }
-	case DirectionDown:
-		dostep = func(x, y int) (int, int) { return x, y + 1 }
-	case DirectionLeft:
-		dostep = func(x, y int) (int, int) { return x - 1, y }
-	case DirectionRight:
-		dostep = func(x, y int) (int, int) { return x + 1, y }
-	}
-
-	p.stepCounter++
-
-	for s := 0; s < p.Speed; s++ {
-		p.X, p.Y = dostep(p.X, p.Y)
-		if p.X < 0 || p.X >= g.Width || p.Y < 0 || p.Y >= g.Height {
-			return jumpAIprogressCrash, r
-		}
-		if p.Speed >= HoleSpeed && p.stepCounter%HolesEachStep == 0 && s != 0 && s != p.Speed-1 {
-			if g.Cells[p.Y][p.X] != 0 {
+	jump := false
+	alive := Advance(g, p, func(x, y int, hole bool) bool {
+		if hole {
+			if g.Cells[y][x] != 0 {
 				jump = true
 			}
-			continue
+			return true
 		}
-		if g.Cells[p.Y][p.X] != 0 {
-			return jumpAIprogressCrash, r
+		if g.Cells[y][x] != 0 {
+			return false
 		}
-		r.Cells = append(r.Cells, struct{ X, Y int }{p.X, p.Y})
-		g.Cells[p.Y][p.X] = -33
-	}
+		r.Cells = append(r.Cells, struct{ X, Y int }{x, y})
+		g.Cells[y][x] = -33
+		return true
+	})
 
+	if !alive {
+		return jumpAIprogressCrash, r
+	}
 	if jump {
 		return jumpAIprogressJump, r
 	}
@@ -297,85 +261,38 @@ func (j *JumpAI) executePlan(g *Game, plan []string) bool {
 		}
 	}()
 
-	sc := g.Players[g.You].stepCounter
-	direction := g.Players[g.You].Direction
-	speed := g.Players[g.You].Speed
-	x, y := g.Players[g.You].X, g.Players[g.You].Y
+	p := &Player{
+		X:           g.Players[g.You].X,
+		Y:           g.Players[g.You].Y,
+		Direction:   g.Players[g.You].Direction,
+		Speed:       g.Players[g.You].Speed,
+		stepCounter: g.Players[g.You].stepCounter,
+	}
 
 	// Execute plan
 	jump := false
 	for i := range plan {
-		switch plan[i] {
-		case ActionTurnLeft:
-			switch direction {
-			case DirectionLeft:
-				direction = DirectionDown
-			case DirectionRight:
-				direction = DirectionUp
-			case DirectionUp:
-				direction = DirectionLeft
-			case DirectionDown:
-				direction = DirectionRight
-			}
-		case ActionTurnRight:
-			switch direction {
-			case DirectionLeft:
-				direction = DirectionUp
-			case DirectionRight:
-				direction = DirectionDown
-			case DirectionUp:
-				direction = DirectionRight
-			case DirectionDown:
-				direction = DirectionLeft
-			}
-		case ActionFaster:
-			speed++
-			if speed > MaxSpeed {
-				return false
-			}
-		case ActionSlower:
-			speed--
-			if speed < 1 {
-				return false
-			}
-		case ActionNOOP:
-			// Do nothing
-		default:
-			log.Println("jump ai:", "unknown action", plan[i])
+		if !ApplyAction(g, p, plan[i]) {
+			return false
 		}
 
-		var dostep func(x, y int) (int, int)
-		switch direction {
-		case DirectionUp:
-			dostep = func(x, y int) (int, int) { return x, y - 1 }
-		case DirectionDown:
-			dostep = func(x, y int) (int, int) { return x, y + 1 }
-		case DirectionLeft:
-			dostep = func(x, y int) (int, int) { return x - 1, y }
-		case DirectionRight:
-			dostep = func(x, y int) (int, int) { return x + 1, y }
-		}
-
-		sc++
-
-		for s := 0; s < speed; s++ {
-			x, y = dostep(x, y)
-			if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
-				return false
-			}
-			if speed >= HoleSpeed && sc%HolesEachStep == 0 && s != 0 && s != speed-1 {
+		alive := Advance(g, p, func(x, y int, hole bool) bool {
+			if hole {
 				if g.Cells[y][x] != 0 {
 					jump = true
 				}
-				continue
+				return true
 			}
 			if g.Cells[y][x] != 0 {
 				return false
 			}
 			g.Cells[y][x] = -33
 			revert = append(revert, struct{ X, Y int }{x, y})
+			return true
+		})
+		if !alive {
+			return false
 		}
-
 	}
 
 	return jump
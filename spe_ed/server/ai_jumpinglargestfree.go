@@ -16,6 +16,7 @@
 package main
 
 import (
+	"math/rand"
 	"sync"
 )
 
@@ -37,6 +38,7 @@ type JumpingLargestFreeAI struct {
 	largestfree       AI
 	jump              AI
 	freeCountingSlice []bool
+	r                 *rand.Rand
 }
 
 // GetChannel receives the answer channel.
@@ -55,6 +57,14 @@ func (jlf *JumpingLargestFreeAI) GetChannel(c chan string) {
 	}
 }
 
+// SetSeed sets the seed of the random number generator used by the AI.
+func (jlf *JumpingLargestFreeAI) SetSeed(seed int64) {
+	jlf.l.Lock()
+	defer jlf.l.Unlock()
+
+	jlf.r = rand.New(rand.NewSource(seed))
+}
+
 // GetState gets the game state and computes an answer.
 func (jlf *JumpingLargestFreeAI) GetState(g *Game) {
 	jlf.l.Lock()
@@ -64,8 +74,13 @@ func (jlf *JumpingLargestFreeAI) GetState(g *Game) {
 		return
 	}
 
+	if jlf.r == nil {
+		jlf.r = rand.New(rand.NewSource(rand.Int63()))
+	}
+
 	if jlf.largestfree == nil {
 		jlf.largestfree = new(LargestFreeAI)
+		jlf.largestfree.SetSeed(jlf.r.Int63())
 		jlf.largestfree.GetChannel(jlf.i)
 	}
 
@@ -73,6 +88,7 @@ func (jlf *JumpingLargestFreeAI) GetState(g *Game) {
 		if jlf.freeSpaceConnected(g.Players[g.You].X, g.Players[g.You].Y, JumpingLargestFreeAIJumpAtLessThanFree+1, g) < JumpingLargestFreeAIJumpAtLessThanFree {
 			if jlf.jump == nil {
 				jlf.jump = new(JumpAI)
+				jlf.jump.SetSeed(jlf.r.Int63())
 				jlf.jump.GetChannel(jlf.i)
 			}
 			jlf.jump.GetState(g)
@@ -95,6 +111,7 @@ func (jlf *JumpingLargestFreeAI) GetState(g *Game) {
 
 			for i := 0; i < g.Players[g.You].Speed-1; i++ {
 				x, y = dostep(x, y)
+				x, y = Wrap(g, x, y)
 				if x < 0 || x >= g.Width || y < 0 || y >= g.Height || g.Cells[y][x] != 0 {
 					possible = false
 					break
@@ -126,6 +143,7 @@ func (jlf *JumpingLargestFreeAI) GetState(g *Game) {
 
 			for i := 0; i < g.Players[g.You].Speed; i++ {
 				x, y = dostep(x, y)
+				x, y = Wrap(g, x, y)
 				if x < 0 || x >= g.Width || y < 0 || y >= g.Height || g.Cells[y][x] != 0 {
 					possible = false
 					break
@@ -157,6 +175,7 @@ func (jlf *JumpingLargestFreeAI) GetState(g *Game) {
 
 			for i := 0; i < g.Players[g.You].Speed; i++ {
 				x, y = dostep(x, y)
+				x, y = Wrap(g, x, y)
 				if x < 0 || x >= g.Width || y < 0 || y >= g.Height || g.Cells[y][x] != 0 {
 					possible = false
 					break
@@ -218,6 +237,7 @@ func (jlf *JumpingLargestFreeAI) freeSpaceConnectedInternal(x, y, cutoff, curren
 		return current
 	}
 
+	x, y = Wrap(g, x, y)
 	if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
 		return current
 	}
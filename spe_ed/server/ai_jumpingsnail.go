@@ -16,6 +16,7 @@
 package main
 
 import (
+	"math/rand"
 	"sync"
 )
 
@@ -37,6 +38,7 @@ type JumpingSnailAI struct {
 	snail             AI
 	jump              AI
 	freeCountingSlice []bool
+	r                 *rand.Rand
 }
 
 // GetChannel receives the answer channel.
@@ -55,6 +57,14 @@ func (js *JumpingSnailAI) GetChannel(c chan string) {
 	}
 }
 
+// SetSeed sets the seed of the random number generator used by the AI.
+func (js *JumpingSnailAI) SetSeed(seed int64) {
+	js.l.Lock()
+	defer js.l.Unlock()
+
+	js.r = rand.New(rand.NewSource(seed))
+}
+
 // GetState gets the game state and computes an answer.
 func (js *JumpingSnailAI) GetState(g *Game) {
 	js.l.Lock()
@@ -64,8 +74,13 @@ func (js *JumpingSnailAI) GetState(g *Game) {
 		return
 	}
 
+	if js.r == nil {
+		js.r = rand.New(rand.NewSource(rand.Int63()))
+	}
+
 	if js.snail == nil {
 		js.snail = new(SuperSnailAI)
+		js.snail.SetSeed(js.r.Int63())
 		js.snail.GetChannel(js.i)
 	}
 
@@ -73,6 +88,7 @@ func (js *JumpingSnailAI) GetState(g *Game) {
 		if js.freeSpaceConnected(g.Players[g.You].X, g.Players[g.You].Y, JumpingSnailAIJumpAtLessThanFree+1, g) < JumpingSnailAIJumpAtLessThanFree {
 			if js.jump == nil {
 				js.jump = new(JumpAI)
+				js.jump.SetSeed(js.r.Int63())
 				js.jump.GetChannel(js.i)
 			}
 			js.jump.GetState(g)
@@ -96,6 +112,7 @@ func (js *JumpingSnailAI) GetState(g *Game) {
 
 			for i := 0; i < g.Players[g.You].Speed-1; i++ {
 				x, y = dostep(x, y)
+				x, y = Wrap(g, x, y)
 				if x < 0 || x >= g.Width || y < 0 || y >= g.Height || g.Cells[y][x] != 0 {
 					possible = false
 					break
@@ -127,6 +144,7 @@ func (js *JumpingSnailAI) GetState(g *Game) {
 
 			for i := 0; i < g.Players[g.You].Speed; i++ {
 				x, y = dostep(x, y)
+				x, y = Wrap(g, x, y)
 				if x < 0 || x >= g.Width || y < 0 || y >= g.Height || g.Cells[y][x] != 0 {
 					possible = false
 					break
@@ -158,6 +176,7 @@ func (js *JumpingSnailAI) GetState(g *Game) {
 
 			for i := 0; i < g.Players[g.You].Speed; i++ {
 				x, y = dostep(x, y)
+				x, y = Wrap(g, x, y)
 				if x < 0 || x >= g.Width || y < 0 || y >= g.Height || g.Cells[y][x] != 0 {
 					possible = false
 					break
@@ -219,6 +238,7 @@ func (js *JumpingSnailAI) freeSpaceConnectedInternal(x, y, cutoff, current int,
 		return current
 	}
 
+	x, y = Wrap(g, x, y)
 	if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
 		return current
 	}
@@ -39,6 +39,9 @@ func (lf *LargestFreeAI) GetChannel(c chan string) {
 	lf.i = c
 }
 
+// SetSeed is part of the AI interface. LargestFreeAI does not use randomness.
+func (lf *LargestFreeAI) SetSeed(seed int64) {}
+
 // GetState gets the game state and computes an answer.
 func (lf *LargestFreeAI) GetState(g *Game) {
 	lf.l.Lock()
@@ -64,6 +67,7 @@ func (lf *LargestFreeAI) GetState(g *Game) {
 
 			for i := 1; i <= g.Players[k].Speed+1; i++ {
 				x, y := g.Players[k].X+i, g.Players[k].Y
+				x, y = Wrap(g, x, y)
 				if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
 					// invalid - do nothing
 				} else {
@@ -71,6 +75,7 @@ func (lf *LargestFreeAI) GetState(g *Game) {
 				}
 
 				x, y = g.Players[k].X-i, g.Players[k].Y
+				x, y = Wrap(g, x, y)
 				if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
 					// invalid - do nothing
 				} else {
@@ -78,6 +83,7 @@ func (lf *LargestFreeAI) GetState(g *Game) {
 				}
 
 				x, y = g.Players[k].X, g.Players[k].Y+i
+				x, y = Wrap(g, x, y)
 				if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
 					// invalid - do nothing
 				} else {
@@ -85,6 +91,7 @@ func (lf *LargestFreeAI) GetState(g *Game) {
 				}
 
 				x, y = g.Players[k].X, g.Players[k].Y-i
+				x, y = Wrap(g, x, y)
 				if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
 					// invalid - do nothing
 				} else {
@@ -190,6 +197,7 @@ func (lf *LargestFreeAI) GetFree(dostep func(x, y int) (int, int), g *Game) int
 	free := 0
 	for {
 		x, y = dostep(x, y)
+		x, y = Wrap(g, x, y)
 		if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
 			break
 		}
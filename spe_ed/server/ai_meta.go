@@ -33,6 +33,7 @@ type MetaAI struct {
 
 	i  chan string
 	ai AI
+	r  *rand.Rand
 }
 
 // GetChannel receives the answer channel.
@@ -43,6 +44,14 @@ func (meta *MetaAI) GetChannel(c chan string) {
 	meta.i = c
 }
 
+// SetSeed sets the seed of the random number generator used by the AI.
+func (meta *MetaAI) SetSeed(seed int64) {
+	meta.l.Lock()
+	defer meta.l.Unlock()
+
+	meta.r = rand.New(rand.NewSource(seed))
+}
+
 // GetState gets the game state and computes an answer.
 func (meta *MetaAI) GetState(g *Game) {
 	meta.l.Lock()
@@ -52,8 +61,12 @@ func (meta *MetaAI) GetState(g *Game) {
 		return
 	}
 
+	if meta.r == nil {
+		meta.r = rand.New(rand.NewSource(rand.Int63()))
+	}
+
 	if g.Running {
-		if rand.Float64() < 0.1 {
+		if meta.r.Float64() < 0.1 {
 			meta.ai = nil
 		}
 
@@ -78,6 +91,7 @@ func (meta *MetaAI) GetState(g *Game) {
 
 				for i := 0; i < g.Players[g.You].Speed-1; i++ {
 					x, y = dostep(x, y)
+					x, y = Wrap(g, x, y)
 					if x < 0 || x >= g.Width || y < 0 || y >= g.Height || g.Cells[y][x] != 0 {
 						possible = false
 						break
@@ -109,6 +123,7 @@ func (meta *MetaAI) GetState(g *Game) {
 
 				for i := 0; i < g.Players[g.You].Speed; i++ {
 					x, y = dostep(x, y)
+					x, y = Wrap(g, x, y)
 					if x < 0 || x >= g.Width || y < 0 || y >= g.Height || g.Cells[y][x] != 0 {
 						possible = false
 						break
@@ -140,6 +155,7 @@ func (meta *MetaAI) GetState(g *Game) {
 
 				for i := 0; i < g.Players[g.You].Speed; i++ {
 					x, y = dostep(x, y)
+					x, y = Wrap(g, x, y)
 					if x < 0 || x >= g.Width || y < 0 || y >= g.Height || g.Cells[y][x] != 0 {
 						possible = false
 						break
@@ -162,7 +178,8 @@ func (meta *MetaAI) GetState(g *Game) {
 				return
 			}
 			ais := []AI{&LargestFreeAI{}, &SuperSnailAI{}, &StupidAI{}, &RandomAISlow{}}
-			meta.ai = ais[rand.Intn(len(ais))]
+			meta.ai = ais[meta.r.Intn(len(ais))]
+			meta.ai.SetSeed(meta.r.Int63())
 			meta.ai.GetChannel(meta.i)
 		}
 
@@ -17,6 +17,7 @@ package main
 
 import (
 	"math/rand"
+	"sort"
 	"sync"
 )
 
@@ -36,6 +37,7 @@ type MirrorAI struct {
 	targetDirection string
 
 	i chan string
+	r *rand.Rand
 }
 
 // GetChannel receives the answer channel.
@@ -46,6 +48,14 @@ func (m *MirrorAI) GetChannel(c chan string) {
 	m.i = c
 }
 
+// SetSeed sets the seed of the random number generator used by the AI.
+func (m *MirrorAI) SetSeed(seed int64) {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	m.r = rand.New(rand.NewSource(seed))
+}
+
 // GetState gets the game state and computes an answer.
 func (m *MirrorAI) GetState(g *Game) {
 	m.l.Lock()
@@ -55,6 +65,10 @@ func (m *MirrorAI) GetState(g *Game) {
 		return
 	}
 
+	if m.r == nil {
+		m.r = rand.New(rand.NewSource(rand.Int63()))
+	}
+
 	if g.Running && g.Players[g.You].Active {
 		// Is target still active?
 		if m.target != 0 && !g.Players[m.target].Active {
@@ -70,7 +84,8 @@ func (m *MirrorAI) GetState(g *Game) {
 					player = append(player, k)
 				}
 			}
-			m.target = player[rand.Intn(len(player))]
+			sort.Ints(player)
+			m.target = player[m.r.Intn(len(player))]
 
 			// Save data
 			m.targetDirection = g.Players[m.target].Direction
@@ -31,6 +31,7 @@ func init() {
 type RandomAI struct {
 	l sync.Mutex
 	i chan string
+	r *rand.Rand
 }
 
 const (
@@ -46,6 +47,14 @@ func (r *RandomAI) GetChannel(c chan string) {
 	r.i = c
 }
 
+// SetSeed sets the seed of the random number generator used by the AI.
+func (r *RandomAI) SetSeed(seed int64) {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	r.r = rand.New(rand.NewSource(seed))
+}
+
 // GetState gets the game state and computes an answer.
 func (r *RandomAI) GetState(g *Game) {
 	r.l.Lock()
@@ -55,6 +64,10 @@ func (r *RandomAI) GetState(g *Game) {
 		return
 	}
 
+	if r.r == nil {
+		r.r = rand.New(rand.NewSource(rand.Int63()))
+	}
+
 	if g.Running {
 		// Fill potential dead zones
 		for k := range g.Players {
@@ -68,6 +81,7 @@ func (r *RandomAI) GetState(g *Game) {
 
 			for i := 1; i <= g.Players[k].Speed+1; i++ {
 				x, y := g.Players[k].X+i, g.Players[k].Y
+				x, y = Wrap(g, x, y)
 				if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
 					// invalid - do nothing
 				} else {
@@ -75,6 +89,7 @@ func (r *RandomAI) GetState(g *Game) {
 				}
 
 				x, y = g.Players[k].X-i, g.Players[k].Y
+				x, y = Wrap(g, x, y)
 				if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
 					// invalid - do nothing
 				} else {
@@ -82,6 +97,7 @@ func (r *RandomAI) GetState(g *Game) {
 				}
 
 				x, y = g.Players[k].X, g.Players[k].Y+i
+				x, y = Wrap(g, x, y)
 				if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
 					// invalid - do nothing
 				} else {
@@ -89,6 +105,7 @@ func (r *RandomAI) GetState(g *Game) {
 				}
 
 				x, y = g.Players[k].X, g.Players[k].Y-i
+				x, y = Wrap(g, x, y)
 				if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
 					// invalid - do nothing
 				} else {
@@ -99,51 +116,16 @@ func (r *RandomAI) GetState(g *Game) {
 
 		// actions
 		actions := []string{ActionTurnLeft, ActionTurnRight, ActionSlower, ActionFaster, ActionNOOP, ActionNOOP, ActionNOOP, ActionNOOP}
-		rand.Shuffle(len(actions), func(i, j int) { actions[i], actions[j] = actions[j], actions[i] })
+		r.r.Shuffle(len(actions), func(i, j int) { actions[i], actions[j] = actions[j], actions[i] })
 		fallbackAction := ""
 
 		// test actions
 		for i := range actions {
 			// do action
-			switch actions[i] {
-			case ActionTurnLeft:
-				switch g.Players[g.You].Direction {
-				case DirectionLeft:
-					g.Players[g.You].Direction = DirectionDown
-				case DirectionRight:
-					g.Players[g.You].Direction = DirectionUp
-				case DirectionUp:
-					g.Players[g.You].Direction = DirectionLeft
-				case DirectionDown:
-					g.Players[g.You].Direction = DirectionRight
-				}
-			case ActionTurnRight:
-				switch g.Players[g.You].Direction {
-				case DirectionLeft:
-					g.Players[g.You].Direction = DirectionUp
-				case DirectionRight:
-					g.Players[g.You].Direction = DirectionDown
-				case DirectionUp:
-					g.Players[g.You].Direction = DirectionRight
-				case DirectionDown:
-					g.Players[g.You].Direction = DirectionLeft
-				}
-			case ActionFaster:
-				g.Players[g.You].Speed++
-				if g.Players[g.You].Speed > MaxSpeed {
-					g.Players[g.You].Speed--
-					continue
-				}
-			case ActionSlower:
-				g.Players[g.You].Speed--
-				if g.Players[g.You].Speed < 1 {
-					g.Players[g.You].Speed++
-					continue
-				}
-			case ActionNOOP:
-				// Do nothing
-			default:
-				log.Println("random ai:", "unknown action", actions[i])
+			direction, speed := g.Players[g.You].Direction, g.Players[g.You].Speed
+			if !ApplyAction(g, g.Players[g.You], actions[i]) {
+				g.Players[g.You].Direction, g.Players[g.You].Speed = direction, speed
+				continue
 			}
 
 			// test
@@ -159,36 +141,7 @@ func (r *RandomAI) GetState(g *Game) {
 			}
 
 			// undo action
-			switch actions[i] {
-			case ActionTurnLeft:
-				switch g.Players[g.You].Direction {
-				case DirectionLeft:
-					g.Players[g.You].Direction = DirectionUp
-				case DirectionRight:
-					g.Players[g.You].Direction = DirectionDown
-				case DirectionUp:
-					g.Players[g.You].Direction = DirectionRight
-				case DirectionDown:
-					g.Players[g.You].Direction = DirectionLeft
-				}
-			case ActionTurnRight:
-				switch g.Players[g.You].Direction {
-				case DirectionLeft:
-					g.Players[g.You].Direction = DirectionDown
-				case DirectionRight:
-					g.Players[g.You].Direction = DirectionUp
-				case DirectionUp:
-					g.Players[g.You].Direction = DirectionLeft
-				case DirectionDown:
-					g.Players[g.You].Direction = DirectionRight
-				}
-			case ActionFaster:
-				g.Players[g.You].Speed--
-			case ActionSlower:
-				g.Players[g.You].Speed++
-			case ActionNOOP:
-				// Do nothing
-			}
+			g.Players[g.You].Direction, g.Players[g.You].Speed = direction, speed
 		}
 
 		if fallbackAction != "" {
@@ -210,40 +163,32 @@ func (r *RandomAI) GetState(g *Game) {
 // willCrash computes whether the given game state will result in a (possible) crash.
 // Not safe for concurrent use on the same game.
 func (r *RandomAI) willCrash(g *Game) int {
-	oldX, oldY := g.Players[g.You].X, g.Players[g.You].Y
+	p := g.Players[g.You]
+	oldX, oldY, oldStepCounter := p.X, p.Y, p.stepCounter
 	defer func() {
-		g.Players[g.You].X, g.Players[g.You].Y = oldX, oldY
+		p.X, p.Y, p.stepCounter = oldX, oldY, oldStepCounter
 	}()
 
-	var dostep func(x, y int) (int, int)
-	switch g.Players[g.You].Direction {
-	case DirectionUp:
-		dostep = func(x, y int) (int, int) { return x, y - 1 }
-	case DirectionDown:
-		dostep = func(x, y int) (int, int) { return x, y + 1 }
-	case DirectionLeft:
-		dostep = func(x, y int) (int, int) { return x - 1, y }
-	case DirectionRight:
-		dostep = func(x, y int) (int, int) { return x + 1, y }
-	}
-
-	for s := 0; s < g.Players[g.You].Speed; s++ {
-		g.Players[g.You].X, g.Players[g.You].Y = dostep(g.Players[g.You].X, g.Players[g.You].Y)
-		if g.Players[g.You].X < 0 || g.Players[g.You].X >= g.Width || g.Players[g.You].Y < 0 || g.Players[g.You].Y >= g.Height {
-			return randomAISureCrash
-		}
-		if g.Players[g.You].Speed >= HoleSpeed && (g.Players[g.You].stepCounter+1)%HolesEachStep == 0 && s != 0 && s != g.Players[g.You].Speed-1 {
-			continue
+	result := randomAINoCrash
+	alive := Advance(g, p, func(x, y int, hole bool) bool {
+		if hole {
+			return true
 		}
-		if g.Cells[g.Players[g.You].Y][g.Players[g.You].X] == -100 {
-			return randomAIMaybeCrash
+		if g.Cells[y][x] == -100 {
+			result = randomAIMaybeCrash
+			return false
 		}
-		if g.Cells[g.Players[g.You].Y][g.Players[g.You].X] != 0 {
-			return randomAISureCrash
+		if g.Cells[y][x] != 0 {
+			result = randomAISureCrash
+			return false
 		}
-	}
+		return true
+	})
 
-	return randomAINoCrash
+	if !alive && result == randomAINoCrash {
+		return randomAISureCrash
+	}
+	return result
 }
 
 // Name returns the name of the AI.
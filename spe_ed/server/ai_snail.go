@@ -32,6 +32,7 @@ type SnailAI struct {
 	l         sync.Mutex
 	i         chan string
 	direction string
+	r         *rand.Rand
 }
 
 // GetChannel receives the answer channel.
@@ -42,6 +43,14 @@ func (s *SnailAI) GetChannel(c chan string) {
 	s.i = c
 }
 
+// SetSeed sets the seed of the random number generator used by the AI.
+func (s *SnailAI) SetSeed(seed int64) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	s.r = rand.New(rand.NewSource(seed))
+}
+
 // GetState gets the game state and computes an answer.
 func (s *SnailAI) GetState(g *Game) {
 	s.l.Lock()
@@ -51,8 +60,12 @@ func (s *SnailAI) GetState(g *Game) {
 		return
 	}
 
+	if s.r == nil {
+		s.r = rand.New(rand.NewSource(rand.Int63()))
+	}
+
 	if s.direction == "" {
-		if rand.Float32() < 0.5 {
+		if s.r.Float32() < 0.5 {
 			s.direction = DirectionLeft
 		} else {
 			s.direction = DirectionRight
@@ -72,6 +85,7 @@ func (s *SnailAI) GetState(g *Game) {
 			case DirectionRight:
 				nextX, nextY = g.Players[g.You].X, g.Players[g.You].Y+1
 			}
+			nextX, nextY = Wrap(g, nextX, nextY)
 			if nextX >= 0 && nextX < g.Width && nextY >= 0 && nextY < g.Height && g.Cells[nextY][nextX] == 0 {
 				select {
 				case s.i <- ActionTurnRight:
@@ -90,6 +104,7 @@ func (s *SnailAI) GetState(g *Game) {
 			case DirectionRight:
 				nextX, nextY = g.Players[g.You].X+1, g.Players[g.You].Y
 			}
+			nextX, nextY = Wrap(g, nextX, nextY)
 			if nextX >= 0 && nextX < g.Width && nextY >= 0 && nextY < g.Height && g.Cells[nextY][nextX] == 0 {
 				select {
 				case s.i <- ActionNOOP:
@@ -108,6 +123,7 @@ func (s *SnailAI) GetState(g *Game) {
 			case DirectionRight:
 				nextX, nextY = g.Players[g.You].X, g.Players[g.You].Y-1
 			}
+			nextX, nextY = Wrap(g, nextX, nextY)
 			if nextX >= 0 && nextX < g.Width && nextY >= 0 && nextY < g.Height && g.Cells[nextY][nextX] == 0 {
 				select {
 				case s.i <- ActionTurnLeft:
@@ -128,6 +144,7 @@ func (s *SnailAI) GetState(g *Game) {
 			case DirectionRight:
 				nextX, nextY = g.Players[g.You].X, g.Players[g.You].Y-1
 			}
+			nextX, nextY = Wrap(g, nextX, nextY)
 			if nextX >= 0 && nextX < g.Width && nextY >= 0 && nextY < g.Height && g.Cells[nextY][nextX] == 0 {
 				select {
 				case s.i <- ActionTurnLeft:
@@ -146,6 +163,7 @@ func (s *SnailAI) GetState(g *Game) {
 			case DirectionRight:
 				nextX, nextY = g.Players[g.You].X+1, g.Players[g.You].Y
 			}
+			nextX, nextY = Wrap(g, nextX, nextY)
 			if nextX >= 0 && nextX < g.Width && nextY >= 0 && nextY < g.Height && g.Cells[nextY][nextX] == 0 {
 				select {
 				case s.i <- ActionNOOP:
@@ -164,6 +182,7 @@ func (s *SnailAI) GetState(g *Game) {
 			case DirectionRight:
 				nextX, nextY = g.Players[g.You].X, g.Players[g.You].Y+1
 			}
+			nextX, nextY = Wrap(g, nextX, nextY)
 			if nextX >= 0 && nextX < g.Width && nextY >= 0 && nextY < g.Height && g.Cells[nextY][nextX] == 0 {
 				select {
 				case s.i <- ActionTurnRight:
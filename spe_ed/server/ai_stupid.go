@@ -31,6 +31,7 @@ func init() {
 type StupidAI struct {
 	l sync.Mutex
 	i chan string
+	r *rand.Rand
 }
 
 // GetChannel receives the answer channel.
@@ -40,6 +41,14 @@ func (s *StupidAI) GetChannel(c chan string) {
 	s.i = c
 }
 
+// SetSeed sets the seed of the random number generator used by the AI.
+func (s *StupidAI) SetSeed(seed int64) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	s.r = rand.New(rand.NewSource(seed))
+}
+
 // GetState gets the game state and computes an answer.
 func (s *StupidAI) GetState(g *Game) {
 	s.l.Lock()
@@ -49,6 +58,10 @@ func (s *StupidAI) GetState(g *Game) {
 		return
 	}
 
+	if s.r == nil {
+		s.r = rand.New(rand.NewSource(rand.Int63()))
+	}
+
 	if g.Running {
 		p := g.Players[g.You]
 		if s.isFree(p, g) {
@@ -59,7 +72,7 @@ func (s *StupidAI) GetState(g *Game) {
 			return
 		}
 
-		if rand.Float64() < 0.5 {
+		if s.r.Float64() < 0.5 {
 
 			// Turn left
 			switch p.Direction {
@@ -130,6 +143,7 @@ func (s *StupidAI) isFree(p *Player, g *Game) bool {
 	case DirectionRight:
 		x, y = p.X+1, p.Y
 	}
+	x, y = Wrap(g, x, y)
 	if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
 		return false
 	}
@@ -27,10 +27,6 @@ func init() {
 	}
 }
 
-const (
-	superRandomAIPathLength = HolesEachStep * 2
-)
-
 type superSnailAIRevert struct {
 	X, Y, Speed, stepCounter int
 	Direction                string
@@ -42,6 +38,7 @@ type SuperRandomAI struct {
 	l sync.Mutex
 
 	i chan string
+	r *rand.Rand
 }
 
 // GetChannel receives the answer channel.
@@ -52,6 +49,14 @@ func (sr *SuperRandomAI) GetChannel(c chan string) {
 	sr.i = c
 }
 
+// SetSeed sets the seed of the random number generator used by the AI.
+func (sr *SuperRandomAI) SetSeed(seed int64) {
+	sr.l.Lock()
+	defer sr.l.Unlock()
+
+	sr.r = rand.New(rand.NewSource(seed))
+}
+
 // GetState gets the game state and computes an answer.
 func (sr *SuperRandomAI) GetState(g *Game) {
 	sr.l.Lock()
@@ -61,6 +66,10 @@ func (sr *SuperRandomAI) GetState(g *Game) {
 		return
 	}
 
+	if sr.r == nil {
+		sr.r = rand.New(rand.NewSource(rand.Int63()))
+	}
+
 	if g.Running && g.Players[g.You].Active {
 		// Fill potential dead zones
 		for k := range g.Players {
@@ -74,6 +83,7 @@ func (sr *SuperRandomAI) GetState(g *Game) {
 
 			for i := 1; i <= g.Players[k].Speed+1; i++ {
 				x, y := g.Players[k].X+i, g.Players[k].Y
+				x, y = Wrap(g, x, y)
 				if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
 					// invalid - do nothing
 				} else {
@@ -81,6 +91,7 @@ func (sr *SuperRandomAI) GetState(g *Game) {
 				}
 
 				x, y = g.Players[k].X-i, g.Players[k].Y
+				x, y = Wrap(g, x, y)
 				if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
 					// invalid - do nothing
 				} else {
@@ -88,6 +99,7 @@ func (sr *SuperRandomAI) GetState(g *Game) {
 				}
 
 				x, y = g.Players[k].X, g.Players[k].Y+i
+				x, y = Wrap(g, x, y)
 				if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
 					// invalid - do nothing
 				} else {
@@ -95,6 +107,7 @@ func (sr *SuperRandomAI) GetState(g *Game) {
 				}
 
 				x, y = g.Players[k].X, g.Players[k].Y-i
+				x, y = Wrap(g, x, y)
 				if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
 					// invalid - do nothing
 				} else {
@@ -116,20 +129,21 @@ func (sr *SuperRandomAI) GetState(g *Game) {
 		if g.Players[g.You].Speed < 5 {
 			actions = append(actions, ActionFaster)
 		}
-		rand.Shuffle(len(actions), func(i, j int) { actions[i], actions[j] = actions[j], actions[i] })
+		sr.r.Shuffle(len(actions), func(i, j int) { actions[i], actions[j] = actions[j], actions[i] })
 
+		pathLength := g.Rules.HolesEachStep * 2
 		for a := range actions {
 			b, r := sr.progress(g, g.You, actions[a])
 			if !b {
 				sr.revert(g, g.You, r)
 				continue
 			}
-			try := sr.getLength(superRandomAIPathLength, g)
+			try := sr.getLength(pathLength, g)
 			sr.revert(g, g.You, r)
 			if try > best {
 				best = try
 				action = actions[a]
-				if try == superRandomAIPathLength {
+				if try == pathLength {
 					break
 				}
 			}
@@ -137,6 +151,7 @@ func (sr *SuperRandomAI) GetState(g *Game) {
 		if action == "" {
 			// Try finding 1 step - reuse RandomAI
 			ai := RandomAI{}
+			ai.SetSeed(sr.r.Int63())
 			ai.GetChannel(sr.i)
 			ai.GetState(g)
 			return
@@ -199,75 +214,23 @@ func (sr *SuperRandomAI) progress(g *Game, player int, command string) (bool, su
 		Direction:   p.Direction,
 		Cells:       make([]struct{ X, Y int }, 0, p.Speed),
 	}
-	switch command {
-	case ActionTurnLeft:
-		switch p.Direction {
-		case DirectionLeft:
-			p.Direction = DirectionDown
-		case DirectionRight:
-			p.Direction = DirectionUp
-		case DirectionUp:
-			p.Direction = DirectionLeft
-		case DirectionDown:
-			p.Direction = DirectionRight
-		}
-	case ActionTurnRight:
-		switch p.Direction {
-		case DirectionLeft:
-			p.Direction = DirectionUp
-		case DirectionRight:
-			p.Direction = DirectionDown
-		case DirectionUp:
-			p.Direction = DirectionRight
-		case DirectionDown:
-			p.Direction = DirectionLeft
-		}
-	case ActionFaster:
-		p.Speed++
-		if p.Speed > MaxSpeed {
-			return false, r
-		}
-	case ActionSlower:
-		p.Speed--
-		if p.Speed < 1 {
-			return false, r
-		}
-	case ActionNOOP:
-		// Do nothing
-	default:
-		log.Println("jump ai:", "unknown action", command)
+	if !ApplyAction(g, p, command) {
+		return false, r
 	}
 
-	var dostep func(x, y int) (int, int)
-	switch p.Direction {
-	case DirectionUp:
-		dostep = func(x, y int) (int, int) { return x, y - 1 }
-	case DirectionDown:
-		dostep = func(x, y int) (int, int) { return x, y + 1 }
-	case DirectionLeft:
-		dostep = func(x, y int) (int, int) { return x - 1, y }
-	case DirectionRight:
-		dostep = func(x, y int) (int, int) { return x + 1, y }
-	}
-
-	p.stepCounter++
-
-	for s := 0; s < p.Speed; s++ {
-		p.X, p.Y = dostep(p.X, p.Y)
-		if p.X < 0 || p.X >= g.Width || p.Y < 0 || p.Y >= g.Height {
-			return false, r
+	alive := Advance(g, p, func(x, y int, hole bool) bool {
+		if hole {
+			return true
 		}
-		if p.Speed >= HoleSpeed && p.stepCounter%HolesEachStep == 0 && s != 0 && s != p.Speed-1 {
-			continue
+		if g.Cells[y][x] != 0 {
+			return false
 		}
-		if g.Cells[p.Y][p.X] != 0 {
-			return false, r
-		}
-		r.Cells = append(r.Cells, struct{ X, Y int }{p.X, p.Y})
-		g.Cells[p.Y][p.X] = -33
-	}
+		r.Cells = append(r.Cells, struct{ X, Y int }{x, y})
+		g.Cells[y][x] = -33
+		return true
+	})
 
-	return true, r
+	return alive, r
 }
 
 // revert reverts the game state by the revert struct.
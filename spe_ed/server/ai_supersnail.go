@@ -40,6 +40,7 @@ type SuperSnailAI struct {
 	i         chan string
 	direction string
 	round     int
+	r         *rand.Rand
 }
 
 // GetChannel receives the answer channel.
@@ -50,6 +51,14 @@ func (s *SuperSnailAI) GetChannel(c chan string) {
 	s.i = c
 }
 
+// SetSeed sets the seed of the random number generator used by the AI.
+func (s *SuperSnailAI) SetSeed(seed int64) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	s.r = rand.New(rand.NewSource(seed))
+}
+
 // GetState gets the game state and computes an answer.
 func (s *SuperSnailAI) GetState(g *Game) {
 	s.l.Lock()
@@ -59,8 +68,12 @@ func (s *SuperSnailAI) GetState(g *Game) {
 		return
 	}
 
+	if s.r == nil {
+		s.r = rand.New(rand.NewSource(rand.Int63()))
+	}
+
 	if s.direction == "" {
-		if rand.Float32() < 0.5 {
+		if s.r.Float32() < 0.5 {
 			s.direction = DirectionLeft
 		} else {
 			s.direction = DirectionRight
@@ -134,6 +147,7 @@ func (s *SuperSnailAI) getSnailAction(g *Game) string {
 		case DirectionRight:
 			nextX, nextY = g.Players[g.You].X, g.Players[g.You].Y+1
 		}
+		nextX, nextY = Wrap(g, nextX, nextY)
 		if nextX >= 0 && nextX < g.Width && nextY >= 0 && nextY < g.Height && g.Cells[nextY][nextX] == 0 {
 			return ActionTurnRight
 		}
@@ -148,6 +162,7 @@ func (s *SuperSnailAI) getSnailAction(g *Game) string {
 		case DirectionRight:
 			nextX, nextY = g.Players[g.You].X+1, g.Players[g.You].Y
 		}
+		nextX, nextY = Wrap(g, nextX, nextY)
 		if nextX >= 0 && nextX < g.Width && nextY >= 0 && nextY < g.Height && g.Cells[nextY][nextX] == 0 {
 			return ActionNOOP
 		}
@@ -162,6 +177,7 @@ func (s *SuperSnailAI) getSnailAction(g *Game) string {
 		case DirectionRight:
 			nextX, nextY = g.Players[g.You].X, g.Players[g.You].Y-1
 		}
+		nextX, nextY = Wrap(g, nextX, nextY)
 		if nextX >= 0 && nextX < g.Width && nextY >= 0 && nextY < g.Height && g.Cells[nextY][nextX] == 0 {
 			return ActionTurnLeft
 		}
@@ -178,6 +194,7 @@ func (s *SuperSnailAI) getSnailAction(g *Game) string {
 		case DirectionRight:
 			nextX, nextY = g.Players[g.You].X, g.Players[g.You].Y-1
 		}
+		nextX, nextY = Wrap(g, nextX, nextY)
 		if nextX >= 0 && nextX < g.Width && nextY >= 0 && nextY < g.Height && g.Cells[nextY][nextX] == 0 {
 			return ActionTurnLeft
 		}
@@ -192,6 +209,7 @@ func (s *SuperSnailAI) getSnailAction(g *Game) string {
 		case DirectionRight:
 			nextX, nextY = g.Players[g.You].X+1, g.Players[g.You].Y
 		}
+		nextX, nextY = Wrap(g, nextX, nextY)
 		if nextX >= 0 && nextX < g.Width && nextY >= 0 && nextY < g.Height && g.Cells[nextY][nextX] == 0 {
 			return ActionNOOP
 		}
@@ -206,6 +224,7 @@ func (s *SuperSnailAI) getSnailAction(g *Game) string {
 		case DirectionRight:
 			nextX, nextY = g.Players[g.You].X, g.Players[g.You].Y+1
 		}
+		nextX, nextY = Wrap(g, nextX, nextY)
 		if nextX >= 0 && nextX < g.Width && nextY >= 0 && nextY < g.Height && g.Cells[nextY][nextX] == 0 {
 			return ActionTurnRight
 		}
@@ -230,78 +249,23 @@ func (s *SuperSnailAI) progress(g *Game, player int, command string) (bool, supe
 		Direction:   p.Direction,
 		Cells:       make([]struct{ X, Y int }, 0, p.Speed),
 	}
-	switch command {
-	case ActionTurnLeft:
-		switch p.Direction {
-		case DirectionLeft:
-			p.Direction = DirectionDown
-		case DirectionRight:
-			p.Direction = DirectionUp
-		case DirectionUp:
-			p.Direction = DirectionLeft
-		case DirectionDown:
-			p.Direction = DirectionRight
-		}
-	case ActionTurnRight:
-		switch p.Direction {
-		case DirectionLeft:
-			p.Direction = DirectionUp
-		case DirectionRight:
-			p.Direction = DirectionDown
-		case DirectionUp:
-			p.Direction = DirectionRight
-		case DirectionDown:
-			p.Direction = DirectionLeft
-		}
-	case ActionFaster:
-		p.Speed++
-		if p.Speed > MaxSpeed {
-			return false, r
-		}
-	case ActionSlower:
-		p.Speed--
-		if p.Speed < 1 {
-			return false, r
-		}
-	case ActionNOOP:
-		// Do nothing
-	case "":
-		// Abort
+	if !ApplyAction(g, p, command) {
 		return false, r
-	default:
-		log.Println("snail ai:", "unknown action", command)
 	}
 
-	var dostep func(x, y int) (int, int)
-	switch p.Direction {
-	case DirectionUp:
-		dostep = func(x, y int) (int, int) { return x, y - 1 }
-	case DirectionDown:
-		dostep = func(x, y int) (int, int) { return x, y + 1 }
-	case DirectionLeft:
-		dostep = func(x, y int) (int, int) { return x - 1, y }
-	case DirectionRight:
-		dostep = func(x, y int) (int, int) { return x + 1, y }
-	}
-
-	p.stepCounter++
-
-	for s := 0; s < p.Speed; s++ {
-		p.X, p.Y = dostep(p.X, p.Y)
-		if p.X < 0 || p.X >= g.Width || p.Y < 0 || p.Y >= g.Height {
-			return false, r
+	alive := Advance(g, p, func(x, y int, hole bool) bool {
+		if hole {
+			return true
 		}
-		if p.Speed >= HoleSpeed && p.stepCounter%HolesEachStep == 0 && s != 0 && s != p.Speed-1 {
-			continue
-		}
-		if g.Cells[p.Y][p.X] != 0 {
-			return false, r
+		if g.Cells[y][x] != 0 {
+			return false
 		}
-		r.Cells = append(r.Cells, struct{ X, Y int }{p.X, p.Y})
-		g.Cells[p.Y][p.X] = -33
-	}
+		r.Cells = append(r.Cells, struct{ X, Y int }{x, y})
+		g.Cells[y][x] = -33
+		return true
+	})
 
-	return true, r
+	return alive, r
 }
 
 // revert reverts the game state by the revert struct.
@@ -340,6 +304,7 @@ func (s *SuperSnailAI) isInSmallArea(g *Game) bool {
 	}{g.Players[g.You].X, g.Players[g.You].Y - 1}}
 	count := 0
 	for i := range test {
+		test[i].X, test[i].Y = Wrap(g, test[i].X, test[i].Y)
 		if test[i].X < 0 || test[i].X >= g.Width || test[i].Y < 0 || test[i].Y >= g.Height {
 			count++
 			continue
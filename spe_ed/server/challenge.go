@@ -0,0 +1,277 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChallengeTimeout is the time after which a challenge is removed if not all invited players have connected.
+const ChallengeTimeout = 30 * time.Minute
+
+// ErrNotInvited is returned if a player tries to join a challenge without being invited or joins twice.
+var ErrNotInvited = errors.New("not invited")
+
+// Challenge is a private game between invited API keys, optionally filled with named AIs.
+// Keys are invited by their fingerprint (see KeyFingerprint), so no team has to share its key.
+// The game starts as soon as all invited keys have connected. Players losing their connection before the start can join again.
+type Challenge struct {
+	Code    string    `json:"code"`
+	Players int       `json:"players"`
+	AIs     []string  `json:"ais"`
+	Expires time.Time `json:"expires"`
+
+	keys    map[string]*Player // fingerprints of the invited keys with the connected player, nil if not connected
+	game    *Game
+	closed  bool
+	started chan struct{} // closed together with closed
+}
+
+var (
+	challengeLock sync.Mutex
+	challenges    = make(map[string]*Challenge)
+)
+
+// NewChallenge creates a new challenge between the keys given by their fingerprints (see KeyFingerprint) and the AIs (given by name, see GetAINames)
+// and registers it under a new invite code. seed is used for the game, 0 means a random seed.
+func NewChallenge(fingerprints []string, ais []string, seed int64) (*Challenge, error) {
+	players := len(fingerprints) + len(ais)
+	if len(fingerprints) == 0 {
+		return nil, fmt.Errorf("at least one key must be invited")
+	}
+	if players < 2 || players > MaxPlayersPerGame {
+		return nil, fmt.Errorf("number of players must be between 2 and %d", MaxPlayersPerGame)
+	}
+
+	c := &Challenge{
+		Players: players,
+		AIs:     ais,
+		Expires: time.Now().Add(ChallengeTimeout),
+		keys:    make(map[string]*Player, len(fingerprints)),
+		game:    NewGame(seed, players, players),
+		started: make(chan struct{}),
+	}
+	for _, f := range fingerprints {
+		if !IsKeyFingerprint(f) {
+			return nil, fmt.Errorf("invalid fingerprint %q", f)
+		}
+		if _, ok := c.keys[f]; ok {
+			return nil, fmt.Errorf("fingerprint %s invited twice", f)
+		}
+		c.keys[f] = nil
+	}
+	err := c.game.Rules.ValidateGame(players)
+	if err != nil {
+		return nil, err
+	}
+	err = c.game.AddNamedAI(ais)
+	if err != nil {
+		return nil, err
+	}
+
+	challengeLock.Lock()
+	defer challengeLock.Unlock()
+	for {
+		b := make([]byte, 10)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, err
+		}
+		c.Code = base32.StdEncoding.EncodeToString(b)
+		if _, ok := challenges[c.Code]; !ok {
+			break
+		}
+	}
+	challenges[c.Code] = c
+	log.Println("challenge:", c.Code, "created with", fingerprints, "and ais", ais)
+	return c, nil
+}
+
+// GetChallenge returns the challenge with the given invite code or nil if it does not exist.
+func GetChallenge(code string) *Challenge {
+	challengeLock.Lock()
+	defer challengeLock.Unlock()
+	return challenges[code]
+}
+
+// Invited returns whether the key is invited to the challenge and has not connected yet.
+func (c *Challenge) Invited(key string) bool {
+	challengeLock.Lock()
+	defer challengeLock.Unlock()
+
+	p, ok := c.keys[KeyFingerprint(key)]
+	return ok && p == nil && !c.closed
+}
+
+// Join adds a player to the challenge. The game is started as soon as all invited keys have joined.
+// If an error is returned, the player was not added and the caller is responsible for closing it.
+func (c *Challenge) Join(p *Player) error {
+	challengeLock.Lock()
+	defer challengeLock.Unlock()
+
+	fingerprint := KeyFingerprint(p.api)
+	if joined, ok := c.keys[fingerprint]; !ok || joined != nil || c.closed {
+		return ErrNotInvited
+	}
+
+	err := c.game.AddPlayer(p)
+	if err != nil {
+		return err
+	}
+	c.keys[fingerprint] = p
+
+	if c.game.IsReady() {
+		log.Println("challenge:", c.Code, "starting game")
+		c.close()
+		delete(challenges, c.Code)
+		go c.game.RunGame()
+		return nil
+	}
+	go c.watch(fingerprint, p)
+	return nil
+}
+
+// watch removes a waiting player from the challenge if its connection is lost before the game starts, so the key can join again.
+func (c *Challenge) watch(fingerprint string, p *Player) {
+	select {
+	case <-p.Lost():
+	case <-c.started:
+		return
+	}
+
+	challengeLock.Lock()
+	defer challengeLock.Unlock()
+
+	if c.closed || c.keys[fingerprint] != p {
+		return
+	}
+	c.game.RemovePlayer(p)
+	c.keys[fingerprint] = nil
+	log.Println("challenge:", c.Code, "connection lost before start:", fingerprint)
+	go p.Close()
+}
+
+// close marks the challenge as closed, no more players can join.
+// Caller has to lock challengeLock.
+func (c *Challenge) close() {
+	if !c.closed {
+		c.closed = true
+		close(c.started)
+	}
+}
+
+// checkChallenges removes all expired challenges. Players already waiting in an expired challenge are disconnected.
+func checkChallenges() {
+	challengeLock.Lock()
+	defer challengeLock.Unlock()
+
+	now := time.Now()
+	for k, c := range challenges {
+		if now.After(c.Expires) {
+			log.Println("challenge:", c.Code, "expired")
+			c.close()
+			delete(challenges, k)
+			go c.game.ClosePlayers()
+		}
+	}
+}
+
+// challengeEndpoint creates a new challenge. It expects a POST request with the parameters
+// "key" (API key of the creator), "players" (comma separated list of invited players given by pseudonym or key fingerprint,
+// the creator is always invited),
+// "ais" (optional, comma separated list of AI names) and "seed" (optional).
+// The challenge is returned as JSON, players join by connecting to /spe_ed with the parameter "invite" set to the code.
+func challengeEndpoint(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := r.FormValue("key")
+	if !IsValidKey(key) {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	fingerprints := []string{KeyFingerprint(key)}
+	for _, player := range splitList(r.FormValue("players")) {
+		f := player
+		if !IsKeyFingerprint(f) {
+			var ok bool
+			f, ok = GlobalPseudonym.Lookup(player)
+			if !ok || !IsKeyFingerprint(f) {
+				rw.WriteHeader(http.StatusBadRequest)
+				rw.Write([]byte(fmt.Sprintf("unknown player %q", player)))
+				return
+			}
+		}
+		if f != fingerprints[0] {
+			fingerprints = append(fingerprints, f)
+		}
+	}
+
+	ais := splitList(r.FormValue("ais"))
+
+	var seed int64
+	if s := r.FormValue("seed"); s != "" {
+		var err error
+		seed, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+	}
+
+	c, err := NewChallenge(fingerprints, ais, seed)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte(err.Error()))
+		return
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		log.Println("challenge:", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		rw.Write([]byte(err.Error()))
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	rw.Write(b)
+}
+
+// splitList splits a comma separated list. Whitespace around the elements is removed, empty elements are dropped.
+func splitList(s string) []string {
+	list := make([]string, 0)
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		if e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
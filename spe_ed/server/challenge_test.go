@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// removeChallenge removes a challenge created by a test.
+func removeChallenge(c *Challenge) {
+	challengeLock.Lock()
+	defer challengeLock.Unlock()
+	c.close()
+	delete(challenges, c.Code)
+}
+
+func TestNewChallenge(t *testing.T) {
+	ai := GetAINames()[0]
+	tests := []struct {
+		name         string
+		fingerprints []string
+		ais          []string
+		err          string // empty if the challenge is valid
+	}{
+		{"two keys", []string{KeyFingerprint("a"), KeyFingerprint("b")}, nil, ""},
+		{"key and ai", []string{KeyFingerprint("a")}, []string{ai}, ""},
+		{"no key", nil, []string{ai, ai}, "at least one key"},
+		{"single player", []string{KeyFingerprint("a")}, nil, "number of players"},
+		{"too many players", []string{KeyFingerprint("a")}, make([]string, MaxPlayersPerGame), "number of players"},
+		{"plain key", []string{KeyFingerprint("a"), "b"}, nil, "invalid fingerprint"},
+		{"invited twice", []string{KeyFingerprint("a"), KeyFingerprint("a")}, nil, "invited twice"},
+		{"unknown ai", []string{KeyFingerprint("a")}, []string{"NoSuchAI"}, "NoSuchAI"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewChallenge(tt.fingerprints, tt.ais, 0)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer removeChallenge(c)
+				if GetChallenge(c.Code) != c || c.Players != len(tt.fingerprints)+len(tt.ais) {
+					t.Errorf("got challenge %+v", c)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestChallengeJoin(t *testing.T) {
+	c, err := NewChallenge([]string{KeyFingerprint("a"), KeyFingerprint("b")}, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer removeChallenge(c)
+
+	if !c.Invited("a") || !c.Invited("b") || c.Invited("c") {
+		t.Fatal("wrong keys invited")
+	}
+	if err := c.Join(&Player{api: "c"}); err != ErrNotInvited {
+		t.Errorf("uninvited key: got error %v", err)
+	}
+
+	first := &Player{api: "a"}
+	if err := c.Join(first); err != nil {
+		t.Fatal(err)
+	}
+	if c.Invited("a") || !c.game.ContainsAPI("a") {
+		t.Error("joined key is still invited")
+	}
+	if err := c.Join(&Player{api: "a"}); err != ErrNotInvited {
+		t.Errorf("second join: got error %v", err)
+	}
+
+	// Losing the connection before the start allows to join again
+	close(first.lostChannel())
+	waitFor(t, "player removal", func() bool { return c.Invited("a") })
+	if c.game.ContainsAPI("a") {
+		t.Error("player with lost connection is still part of the game")
+	}
+	if err := c.Join(&Player{api: "a"}); err != nil {
+		t.Errorf("join after lost connection: %v", err)
+	}
+
+	// Expired challenges can not be joined
+	challengeLock.Lock()
+	c.Expires = time.Now().Add(-time.Second)
+	challengeLock.Unlock()
+	checkChallenges()
+	if GetChallenge(c.Code) != nil || c.Invited("b") {
+		t.Error("challenge did not expire")
+	}
+	if err := c.Join(&Player{api: "b"}); err != ErrNotInvited {
+		t.Errorf("join after expiry: got error %v", err)
+	}
+}
+
+func TestChallengeEndpoint(t *testing.T) {
+	useKeys(t, "creator", "friend")
+	usePseudonyms(t, map[string]string{KeyFingerprint("friend"): "Some-Team-Name"})
+	ai := GetAINames()[0]
+
+	tests := []struct {
+		name    string
+		method  string
+		form    url.Values
+		status  int
+		players int    // number of players of the created challenge
+		body    string // part of the error message
+	}{
+		{"pseudonym", http.MethodPost, url.Values{"key": {"creator"}, "players": {"Some-Team-Name"}}, http.StatusOK, 2, ""},
+		{"fingerprint and ai", http.MethodPost, url.Values{"key": {"creator"}, "players": {KeyFingerprint("friend")}, "ais": {ai}}, http.StatusOK, 3, ""},
+		{"creator invited", http.MethodPost, url.Values{"key": {"creator"}, "players": {KeyFingerprint("creator")}, "ais": {ai}}, http.StatusOK, 2, ""},
+		{"unknown player", http.MethodPost, url.Values{"key": {"creator"}, "players": {"friend"}}, http.StatusBadRequest, 0, `unknown player "friend"`},
+		{"invalid seed", http.MethodPost, url.Values{"key": {"creator"}, "players": {"Some-Team-Name"}, "seed": {"x"}}, http.StatusBadRequest, 0, "invalid syntax"},
+		{"invalid key", http.MethodPost, url.Values{"key": {"nokey"}, "players": {"Some-Team-Name"}}, http.StatusForbidden, 0, ""},
+		{"get", http.MethodGet, nil, http.StatusMethodNotAllowed, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/spe_ed_challenge", strings.NewReader(tt.form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rw := httptest.NewRecorder()
+			challengeEndpoint(rw, r)
+
+			body, _ := ioutil.ReadAll(rw.Result().Body)
+			if rw.Code != tt.status {
+				t.Fatalf("got status %d (%s), want %d", rw.Code, body, tt.status)
+			}
+			if !strings.Contains(string(body), tt.body) {
+				t.Errorf("got body %q, want %q", body, tt.body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var c Challenge
+			err := json.Unmarshal(body, &c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			created := GetChallenge(c.Code)
+			if created == nil {
+				t.Fatal("challenge was not registered")
+			}
+			defer removeChallenge(created)
+			if c.Players != tt.players || !created.Invited("creator") {
+				t.Errorf("got challenge %+v", c)
+			}
+			if tt.players-len(c.AIs) == 2 && !created.Invited("friend") {
+				t.Error("friend was not invited")
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// LoadConfig applies a configuration file to a flag set.
+// The file contains a JSON object mapping flag names (without "-") to their values, e.g. {"wait": "1m", "stats": true}.
+// Flags set on the command line take precedence over the file, so LoadConfig must be called after parsing the command line.
+// All errors (unknown names, invalid values) are collected and returned together.
+func LoadConfig(filename string, fs *flag.FlagSet) error {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	config := make(map[string]interface{})
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber() // Keep large seeds exact
+	err = d.Decode(&config)
+	if err != nil {
+		return fmt.Errorf("config %s: %w", filename, err)
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	names := make([]string, 0, len(config))
+	for k := range config {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var errs []string
+	for _, name := range names {
+		if fs.Lookup(name) == nil {
+			errs = append(errs, fmt.Sprintf("unknown option %s", name))
+			continue
+		}
+		if set[name] {
+			continue
+		}
+		var value string
+		switch v := config[name].(type) {
+		case string:
+			value = v
+		case json.Number, bool:
+			value = fmt.Sprint(v)
+		default:
+			errs = append(errs, fmt.Sprintf("option %s: must be a string, number or boolean", name))
+			continue
+		}
+		err := fs.Set(name, value)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("option %s: %s", name, err))
+		}
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("config %s: %s", filename, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// ValidateSettings checks the game constants and the number of players per game.
+// The default rules are validated for games of the default room, rooms, tournaments and practice games validate them against their own number of players.
+// All errors are collected and returned together.
+func ValidateSettings() error {
+	var errs []string
+
+	if PlayersPerGame < 2 || PlayersPerGame > MaxPlayersPerGame {
+		errs = append(errs, fmt.Sprintf("players must be between 2 and %d", MaxPlayersPerGame))
+	}
+	if err := DefaultRules().Validate(PlayersPerGame); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if err := TrainingRules().ValidateGame(2); err != nil {
+		errs = append(errs, "training: "+err.Error())
+	}
+	if NumberAllowedGames < 1 {
+		errs = append(errs, "number of allowed games must be at least 1")
+	}
+	if NumberTrainingGames < 0 || NumberTrainingGames > MaxTrainingGames {
+		errs = append(errs, fmt.Sprintf("number of training games must be between 0 and %d", MaxTrainingGames))
+	}
+	if PseudonymUpdateInterval <= 0 {
+		errs = append(errs, "pseudonym update interval must be positive")
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("invalid settings: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// configFlags is a flag set with a flag of each type used by the server.
+type configFlags struct {
+	fs    *flag.FlagSet
+	wait  *string
+	stats *bool
+	seed  *int64
+	games *int
+	every *time.Duration
+}
+
+func newConfigFlags(args ...string) (configFlags, error) {
+	var c configFlags
+	c.fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	c.fs.SetOutput(ioutil.Discard)
+	c.wait = c.fs.String("wait", "5m", "")
+	c.stats = c.fs.Bool("stats", false, "")
+	c.seed = c.fs.Int64("seed", 0, "")
+	c.games = c.fs.Int("allowedgames", 1, "")
+	c.every = c.fs.Duration("pseudonyminterval", time.Hour, "")
+	return c, c.fs.Parse(args)
+}
+
+func TestLoadConfig(t *testing.T) {
+	c, err := newConfigFlags("-wait", "1m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := tempFile(t, "config.json", `{"wait": "10m", "stats": true, "seed": 9007199254740993, "allowedgames": 3, "pseudonyminterval": "24h"}`)
+	err = LoadConfig(filename, c.fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *c.wait != "1m" {
+		t.Errorf("command line not preferred: got wait %s", *c.wait)
+	}
+	if !*c.stats || *c.seed != 9007199254740993 || *c.games != 3 || *c.every != 24*time.Hour {
+		t.Errorf("got stats %t, seed %d, allowedgames %d, pseudonyminterval %s", *c.stats, *c.seed, *c.games, *c.every)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		errs   []string // parts of the error message
+	}{
+		{"invalid json", `{"wait": }`, []string{"invalid character"}},
+		{"unknown option", `{"wiat": "1m"}`, []string{"unknown option wiat"}},
+		{"invalid value", `{"allowedgames": "many"}`, []string{"option allowedgames"}},
+		{"invalid type", `{"wait": ["1m"]}`, []string{"option wait: must be a string, number or boolean"}},
+		{"all errors", `{"a": 1, "b": 2, "stats": 3}`, []string{"unknown option a", "unknown option b", "option stats"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newConfigFlags()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = LoadConfig(tempFile(t, "config.json", tt.config), c.fs)
+			if err == nil {
+				t.Fatal("no error for invalid config")
+			}
+			for _, e := range tt.errs {
+				if !strings.Contains(err.Error(), e) {
+					t.Errorf("got error %q, want %q", err, e)
+				}
+			}
+		})
+	}
+
+	c, _ := newConfigFlags()
+	if err := LoadConfig(tempFile(t, "config.json", "{}")+".missing", c.fs); err == nil {
+		t.Error("no error for missing config")
+	}
+}
+
+func TestValidateSettings(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func()
+		err    string // empty if the settings are valid
+	}{
+		{"default", func() {}, ""},
+		{"players", func() { PlayersPerGame = 1 }, "players must be between"},
+		{"field size", func() { FieldMinSize, FieldMaxSize = 50, 40 }, "field"},
+		{"allowed games", func() { NumberAllowedGames = 0 }, "number of allowed games"},
+		{"training games", func() { NumberTrainingGames = -1 }, "number of training games"},
+		{"too many training games", func() { NumberTrainingGames = MaxTrainingGames + 1 }, "number of training games"},
+		{"pseudonym interval", func() { PseudonymUpdateInterval = 0 }, "pseudonym update interval"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			players, min, max, allowed, training, interval := PlayersPerGame, FieldMinSize, FieldMaxSize, NumberAllowedGames, NumberTrainingGames, PseudonymUpdateInterval
+			defer func() {
+				PlayersPerGame, FieldMinSize, FieldMaxSize, NumberAllowedGames, NumberTrainingGames, PseudonymUpdateInterval = players, min, max, allowed, training, interval
+			}()
+			tt.change()
+
+			err := ValidateSettings()
+			if tt.err == "" {
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -17,7 +17,6 @@ package main
 
 import (
 	"net/http"
-	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -25,14 +24,14 @@ import (
 
 var (
 	waitMinutes = 5
+	// maxWaitTime is the waiting time of the default room.
 	maxWaitTime = 5 * time.Minute
+	// gameSeed is the seed used for new games of the default room. 0 means that each game gets a random seed.
+	gameSeed int64
 )
 
 var (
-	currentGameLock       = sync.Mutex{}
-	currentGame     *Game = nil
-	upgrader              = websocket.Upgrader{}
-	newGameTime           = time.Time{}
+	upgrader = websocket.Upgrader{}
 )
 
 func init() {
@@ -42,9 +41,57 @@ func init() {
 }
 
 func endpoint(w http.ResponseWriter, r *http.Request) {
+	// Check room, challenge, practice or training
+	var room *Room
+	var challenge *Challenge
+	var practice *Game
+	var t *Tournament
+	training := false
+	if name := r.URL.Query().Get("tournament"); name != "" {
+		if tournament == nil || tournament.Name() != name {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		t = tournament
+	} else if ais := r.URL.Query().Get("practice"); ais != "" {
+		var err error
+		practice, err = NewPracticeGame(splitList(ais))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+	} else if ais := r.URL.Query().Get("training"); ais != "" {
+		var err error
+		practice, err = NewTrainingGame(splitList(ais))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		training = true
+	} else if code := r.URL.Query().Get("invite"); code != "" {
+		challenge = GetChallenge(code)
+		if challenge == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	} else {
+		room = GetRoom(r.URL.Query().Get("room"))
+		if room == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	}
+
 	// Check API key
 	key := r.URL.Query().Get("key")
-	switch ClaimKey(key) {
+	claimKey, releaseKey := ClaimKey, ReleaseKey
+	if training {
+		claimKey, releaseKey = ClaimTrainingKey, ReleaseTrainingKey
+	}
+	status, claim := claimKey(key)
+	switch status {
 	case KeyOK:
 		break
 	case KeyRateLimit:
@@ -58,98 +105,100 @@ func endpoint(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	currentGameLock.Lock()
-	if currentGame != nil {
-		if currentGame.ContainsAPI(key) {
-			currentGameLock.Unlock()
-			log.Println("keys (in game):", "ratelimit", key)
-			w.WriteHeader(http.StatusTooManyRequests)
-			ReleaseKey(key)
-			return
-		}
+	if t != nil && !t.Scheduled(key) {
+		log.Println("tournament:", t.Name(), "no game scheduled for", KeyFingerprint(key))
+		w.WriteHeader(http.StatusConflict)
+		releaseKey(key, claim)
+		return
 	}
-	currentGameLock.Unlock()
 
-	log.Printf("connection metadata %s: %s", key, r.Header)
+	if challenge != nil && !challenge.Invited(key) {
+		log.Println("challenge:", challenge.Code, "key not invited", KeyFingerprint(key))
+		w.WriteHeader(http.StatusForbidden)
+		releaseKey(key, claim)
+		return
+	}
+
+	if room != nil && room.ContainsAPI(key) {
+		log.Println("keys (in game):", "ratelimit", KeyFingerprint(key))
+		w.WriteHeader(http.StatusTooManyRequests)
+		releaseKey(key, claim)
+		return
+	}
+
+	roomName := "challenge"
+	switch {
+	case room != nil:
+		roomName = room.Name
+	case training:
+		roomName = "training"
+	case practice != nil:
+		roomName = "practice"
+	case t != nil:
+		roomName = "tournament"
+	}
+
+	log.Printf("connection metadata %s (room %s): %s", KeyFingerprint(key), roomName, r.Header)
 
 	// Upgrade connection
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("upgrade:", err)
-		ReleaseKey(key)
+		releaseKey(key, claim)
 		return
 	}
 
 	if statsEnabled {
-		SendLobby <- key
+		SendLobby <- LobbyStats{Key: KeyFingerprint(key), Room: roomName}
 	}
 
 	p := new(Player)
-	p.realName = GlobalPseudonym.Get(key)
+	p.realName = GlobalPseudonym.Get(KeyFingerprint(key))
 	p.ws = conn
 	p.api = key
+	p.apiClaim = claim
+	p.training = training
+	p.teamName = r.URL.Query().Get("team")
 	p.Input = make(chan string, 5)
+	registerConnection(p)
 	go p.readWorker()
 
 	// Attach to game
-	currentGameLock.Lock()
-	defer currentGameLock.Unlock()
-
-	if currentGame == nil {
-		currentGame = new(Game)
-		newGameTime = time.Now()
+	if t != nil {
+		err := t.Join(p)
+		if err != nil {
+			log.Println("tournament:", t.Name(), "join:", err)
+			p.Close()
+		}
+		return
 	}
-
-	err = currentGame.AddPlayer(p)
-	if err == ErrFullGame {
-		if currentGame.IsReady() {
-			go currentGame.RunGame()
-			currentGame = new(Game)
-			newGameTime = time.Now()
-			if err := currentGame.AddPlayer(p); err != nil {
-				log.Println("endpoint:", "add player second time:", err)
-				conn.Close()
-				return
-			}
-		} else {
-			log.Println("endpoint:", "full game, but not ready")
-			conn.Close()
+	if practice != nil {
+		err := practice.AddPlayer(p)
+		if err != nil {
+			log.Println("practice: add player:", err)
+			p.Close()
 			return
 		}
+		go practice.RunGame()
+		return
 	}
-
-	if currentGame.IsReady() {
-		go currentGame.RunGame()
-		currentGame = nil
+	if challenge != nil {
+		err := challenge.Join(p)
+		if err != nil {
+			log.Println("challenge:", challenge.Code, "join:", err)
+			p.Close()
+		}
+		return
 	}
+	room.Join(p)
 }
 
 func gameStarterWorker() {
 	for {
 		time.Sleep(1 * time.Second)
-		currentGameLock.Lock()
-		if currentGame == nil {
-			currentGameLock.Unlock()
-			continue
-		}
-
-		if time.Now().Sub(newGameTime) > maxWaitTime {
-			for !currentGame.IsReady() {
-				missing := currentGame.MissingPlayer()
-				ais := GetAI(missing)
-				for i := range ais {
-					p := new(Player)
-					p.realName = ais[i].API
-					p.underlyingAI = ais[i].AI
-					p.Input = make(chan string, 5)
-					p.underlyingAI.GetChannel(p.Input)
-					currentGame.AddPlayer(p)
-				}
-			}
-			go currentGame.RunGame()
-			currentGame = nil
+		for _, r := range GetRooms() {
+			r.check()
 		}
-
-		currentGameLock.Unlock()
+		checkChallenges()
 	}
 }
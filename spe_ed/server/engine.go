@@ -0,0 +1,437 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// This file contains the rules of spe_ed. All functions are free of side effects outside of the arguments they are given,
+// so they can be used by the server, the AIs and offline tools alike.
+
+const (
+	// EventEliminated is the event type for a player which is no longer active.
+	EventEliminated = "eliminated"
+)
+
+// EliminationReason describes why a player was eliminated.
+type EliminationReason string
+
+const (
+	// EliminationTimeout is used if a player did not send an action before the deadline.
+	EliminationTimeout EliminationReason = "timeout"
+	// EliminationInvalidAnswer is used if a player sent an empty or unknown action.
+	EliminationInvalidAnswer EliminationReason = "invalid_answer"
+	// EliminationDuplicateAnswer is used if a player sent more than one action in a round.
+	EliminationDuplicateAnswer EliminationReason = "duplicate_answer"
+	// EliminationDisconnected is used if the connection to a player was closed.
+	EliminationDisconnected EliminationReason = "disconnected"
+	// EliminationTooFast is used if a player exceeded the maximum speed of the rules.
+	EliminationTooFast EliminationReason = "too_fast"
+	// EliminationTooSlow is used if the speed of a player dropped below 1.
+	EliminationTooSlow EliminationReason = "too_slow"
+	// EliminationLeftBoard is used if a player left the board.
+	EliminationLeftBoard EliminationReason = "left_board"
+	// EliminationCrash is used if a player crashed into a trail or another player.
+	EliminationCrash EliminationReason = "crash"
+)
+
+// Elimination holds why and when a player was eliminated.
+// Opponent is the player responsible for the elimination (e.g. whose trail was hit) or 0 if there is none.
+type Elimination struct {
+	Reason   EliminationReason `json:"reason"`
+	Round    int               `json:"round"`
+	Opponent int               `json:"opponent,omitempty"`
+}
+
+// Event represents something that happened while computing a round.
+// Reason and Opponent are only set for EventEliminated.
+type Event struct {
+	Type     string            `json:"type"`
+	Round    int               `json:"round"`
+	Player   int               `json:"player"`
+	Reason   EliminationReason `json:"reason,omitempty"`
+	Opponent int               `json:"opponent,omitempty"`
+}
+
+const (
+	// SuddenDeathRing fills the board ring by ring from the outside during sudden death.
+	SuddenDeathRing = "ring"
+	// SuddenDeathBlocks adds random blocks of obstacles during sudden death.
+	SuddenDeathBlocks = "blocks"
+)
+
+// Position is a cell of the board.
+type Position struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// Placement holds the final place of a player in a game, starting at 1.
+type Placement struct {
+	Player int `json:"player"`
+	Place  int `json:"place"`
+}
+
+// turnLeft returns the direction after turning left.
+func turnLeft(direction string) string {
+	switch direction {
+	case DirectionLeft:
+		return DirectionDown
+	case DirectionRight:
+		return DirectionUp
+	case DirectionUp:
+		return DirectionLeft
+	case DirectionDown:
+		return DirectionRight
+	}
+	return direction
+}
+
+// turnRight returns the direction after turning right.
+func turnRight(direction string) string {
+	switch direction {
+	case DirectionLeft:
+		return DirectionUp
+	case DirectionRight:
+		return DirectionDown
+	case DirectionUp:
+		return DirectionRight
+	case DirectionDown:
+		return DirectionLeft
+	}
+	return direction
+}
+
+// stepFunc returns a function which moves a position one cell into the given direction.
+func stepFunc(direction string) func(x, y int) (int, int) {
+	switch direction {
+	case DirectionUp:
+		return func(x, y int) (int, int) { return x, y - 1 }
+	case DirectionDown:
+		return func(x, y int) (int, int) { return x, y + 1 }
+	case DirectionLeft:
+		return func(x, y int) (int, int) { return x - 1, y }
+	case DirectionRight:
+		return func(x, y int) (int, int) { return x + 1, y }
+	}
+	return func(x, y int) (int, int) { return x, y }
+}
+
+// ApplyAction changes direction or speed of the player according to the action.
+// It returns false if the action is invalid or the resulting speed is not between 1 and the maximum speed of the game rules. In that case the player must be eliminated.
+func ApplyAction(g *Game, p *Player, action string) bool {
+	switch action {
+	case ActionTurnLeft:
+		p.Direction = turnLeft(p.Direction)
+	case ActionTurnRight:
+		p.Direction = turnRight(p.Direction)
+	case ActionFaster:
+		p.Speed++
+		if p.Speed > g.Rules.MaxSpeed {
+			return false
+		}
+	case ActionSlower:
+		p.Speed--
+		if p.Speed < 1 {
+			return false
+		}
+	case ActionNOOP:
+		// Do nothing
+	default:
+		return false
+	}
+	return true
+}
+
+// IsHole returns whether the step s (starting at 0) of a move with the given speed jumps over its cell.
+// stepCounter must be the step counter of the player including the current move.
+func IsHole(g *Game, speed, stepCounter, s int) bool {
+	return speed >= g.Rules.HoleSpeed && stepCounter%g.Rules.HolesEachStep == 0 && s != 0 && s != speed-1
+}
+
+// Wrap returns the position on the board for a position which might be outside of it.
+// If the game is played on a torus (see Rules.Torus), the position is wrapped around to the opposite side of the board.
+// Otherwise, the position is returned unchanged and might still be outside of the board.
+func Wrap(g *Game, x, y int) (int, int) {
+	if !g.Rules.Torus || g.Width <= 0 || g.Height <= 0 {
+		return x, y
+	}
+	x %= g.Width
+	if x < 0 {
+		x += g.Width
+	}
+	y %= g.Height
+	if y < 0 {
+		y += g.Height
+	}
+	return x, y
+}
+
+// Advance moves the player by one round according to its direction and speed. This includes increasing the step counter.
+// visit is called for every cell the player passes, hole is true if the player jumps over that cell. If visit returns false, the move stops at that cell.
+// Advance returns false if the move was not completed, either because the player left the board or because visit returned false.
+// On a torus (see Rules.Torus) the player can not leave the board, it enters on the opposite side instead.
+// The cells of the game are never modified by Advance.
+func Advance(g *Game, p *Player, visit func(x, y int, hole bool) bool) bool {
+	dostep := stepFunc(p.Direction)
+	p.stepCounter++
+
+	for s := 0; s < p.Speed; s++ {
+		p.X, p.Y = dostep(p.X, p.Y)
+		p.X, p.Y = Wrap(g, p.X, p.Y)
+		if p.X < 0 || p.X >= g.Width || p.Y < 0 || p.Y >= g.Height {
+			return false
+		}
+		if !visit(p.X, p.Y, IsHole(g, p.Speed, p.stepCounter, s)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Step computes the next round of the game. g itself is not modified.
+// actions must contain the action of each active player; active players without a valid action are eliminated.
+// It returns the new state (as returned by Game.PublicCopy) and all events which happened during the round.
+// Eliminated players are marked inactive and get their Elimination set.
+func Step(g *Game, actions map[int]string) (*Game, []Event) {
+	next := g.PublicCopy()
+	next.round = g.round + 1
+	next.NewCells = nil
+	events := make([]Event, 0)
+	ids := playerIDs(next)
+
+	eliminate := func(i int, reason EliminationReason, opponent int) {
+		if !next.Players[i].Active {
+			return
+		}
+		e := Event{Type: EventEliminated, Round: g.round, Player: i, Reason: reason, Opponent: opponent}
+		next.Players[i].Active = false
+		next.Players[i].Elimination = &Elimination{Reason: reason, Round: e.Round, Opponent: opponent}
+		events = append(events, e)
+	}
+
+	// Process actions
+	for _, i := range ids {
+		if !next.Players[i].Active {
+			continue
+		}
+		if !ApplyAction(next, next.Players[i], actions[i]) {
+			eliminate(i, actionEliminationReason(actions[i]), 0)
+		}
+	}
+
+	// Do movement
+	// visitors holds for each cell entered in this round the previous value of the cell followed by all players entering it.
+	paths := make(map[int][]struct{ X, Y int }, len(ids))
+	visitors := make(map[struct{ X, Y int }][]int)
+	for _, i := range ids {
+		if !next.Players[i].Active {
+			continue
+		}
+		path := make([]struct{ X, Y int }, 0, next.Players[i].Speed)
+		ok := Advance(next, next.Players[i], func(x, y int, hole bool) bool {
+			if hole {
+				return true
+			}
+			c := struct{ X, Y int }{x, y}
+			if _, ok := visitors[c]; !ok {
+				visitors[c] = []int{int(next.Cells[y][x])}
+			}
+			visitors[c] = append(visitors[c], i)
+			if next.Cells[y][x] != 0 {
+				next.Cells[y][x] = -1
+			} else {
+				next.Cells[y][x] = int8(i)
+			}
+			path = append(path, c)
+			return true
+		})
+		if !ok {
+			eliminate(i, EliminationLeftBoard, 0)
+		}
+		paths[i] = path
+	}
+
+	// Check crash
+	for _, i := range ids {
+		if !next.Players[i].Active {
+			continue
+		}
+		for _, c := range paths[i] {
+			if next.Cells[c.Y][c.X] == -1 {
+				eliminate(i, EliminationCrash, crashOpponent(visitors[c], i))
+				break
+			}
+		}
+	}
+
+	return next, events
+}
+
+// SuddenDeath fills free cells with obstacles if sudden death is active in the current round (see Rules.SuddenDeathRound).
+// Depending on Rules.SuddenDeathMode, either the next ring of the board (starting at the edge) or random blocks are filled each Rules.SuddenDeathInterval rounds.
+// The cells of g are modified and the filled cells are returned. rng is only used for random blocks.
+func SuddenDeath(g *Game, rng *rand.Rand) []Position {
+	r := g.Rules
+	if r.SuddenDeathRound <= 0 || g.round <= r.SuddenDeathRound || r.SuddenDeathInterval < 1 || (g.round-r.SuddenDeathRound-1)%r.SuddenDeathInterval != 0 {
+		return nil
+	}
+	step := (g.round - r.SuddenDeathRound - 1) / r.SuddenDeathInterval
+
+	filled := make([]Position, 0)
+	fill := func(x, y int) {
+		if x >= 0 && x < g.Width && y >= 0 && y < g.Height && g.Cells[y][x] == 0 {
+			g.Cells[y][x] = CellObstacle
+			filled = append(filled, Position{x, y})
+		}
+	}
+
+	switch r.SuddenDeathMode {
+	case SuddenDeathRing:
+		for x := step; x < g.Width-step; x++ {
+			fill(x, step)
+			fill(x, g.Height-1-step)
+		}
+		for y := step; y < g.Height-step; y++ {
+			fill(step, y)
+			fill(g.Width-1-step, y)
+		}
+	case SuddenDeathBlocks:
+		target := g.Width * g.Height / 100
+		if target < 1 {
+			target = 1
+		}
+		for try := 0; len(filled) < target && try < 100*target; try++ {
+			w, h := rng.Intn(3)+1, rng.Intn(3)+1
+			bx, by := rng.Intn(g.Width), rng.Intn(g.Height)
+			for y := by; y < by+h && len(filled) < target; y++ {
+				for x := bx; x < bx+w && len(filled) < target; x++ {
+					fill(x, y)
+				}
+			}
+		}
+	}
+	return filled
+}
+
+// Ranking returns the placement of all players ordered by place (and player id for ties).
+// Active players are placed before all eliminated players, eliminated players are ordered by the round of their elimination.
+// Players eliminated in the same round share the same place, the following place is skipped accordingly (e.g. 1, 2, 2, 4).
+func Ranking(g *Game) []Placement {
+	// lastRound holds the round a player was eliminated in. Active players get the highest value.
+	lastRound := func(i int) int {
+		p := g.Players[i]
+		if p.Active {
+			return int(^uint(0) >> 1)
+		}
+		if p.Elimination == nil {
+			return 0
+		}
+		return p.Elimination.Round
+	}
+
+	return rank(playerIDs(g), lastRound)
+}
+
+// TeamRanking returns the placement of all teams (see Player.Team) ordered by place (and team for ties). Placement.Player holds the team.
+// A team is placed according to its best placed player, see Ranking. Returns nil if the game is not played in teams.
+func TeamRanking(g *Game) []Placement {
+	if g.Rules.TeamSize < 2 {
+		return nil
+	}
+
+	teamRound := make(map[int]int)
+	for _, p := range Ranking(g) {
+		// Ranking is ordered, so the first player of a team is the best placed one
+		if _, ok := teamRound[g.Players[p.Player].Team]; !ok {
+			teamRound[g.Players[p.Player].Team] = -p.Place
+		}
+	}
+	teams := make([]int, 0, len(teamRound))
+	for t := range teamRound {
+		teams = append(teams, t)
+	}
+	sort.Ints(teams)
+	return rank(teams, func(t int) int { return teamRound[t] })
+}
+
+// rank places ids ordered by lastRound (highest first). Ids with the same value share the same place, the following place is skipped accordingly.
+func rank(ids []int, lastRound func(int) int) []Placement {
+	sort.SliceStable(ids, func(a, b int) bool { return lastRound(ids[a]) > lastRound(ids[b]) })
+
+	ranking := make([]Placement, len(ids))
+	for k, i := range ids {
+		ranking[k] = Placement{Player: i, Place: k + 1}
+		if k > 0 && lastRound(i) == lastRound(ids[k-1]) {
+			ranking[k].Place = ranking[k-1].Place
+		}
+	}
+	return ranking
+}
+
+// Winner returns the winning player of a ranking or -1 for a draw.
+func Winner(ranking []Placement) int {
+	if len(ranking) == 0 || (len(ranking) > 1 && ranking[1].Place == 1) {
+		return -1
+	}
+	return ranking[0].Player
+}
+
+// actionEliminationReason returns why an action rejected by ApplyAction leads to an elimination.
+func actionEliminationReason(action string) EliminationReason {
+	switch action {
+	case "":
+		return EliminationTimeout
+	case ActionFaster:
+		return EliminationTooFast
+	case ActionSlower:
+		return EliminationTooSlow
+	}
+	return EliminationInvalidAnswer
+}
+
+// crashOpponent returns the player responsible for a crash of player p in a cell.
+// visitors must contain the previous value of the cell followed by all players entering it in this round.
+// The owner of an existing trail is preferred over players entering the cell at the same time. 0 is returned if p crashed into its own trail or the owner is unknown.
+func crashOpponent(visitors []int, p int) int {
+	if len(visitors) == 0 {
+		return 0
+	}
+	if visitors[0] != 0 {
+		if visitors[0] == p || visitors[0] < 0 {
+			return 0
+		}
+		return visitors[0]
+	}
+	for _, v := range visitors[1:] {
+		if v != p {
+			return v
+		}
+	}
+	return 0
+}
+
+// playerIDs returns the ids of all players of the game in ascending order.
+func playerIDs(g *Game) []int {
+	ids := make([]int, 0, len(g.Players))
+	for i := range g.Players {
+		ids = append(ids, i)
+	}
+	sort.Ints(ids)
+	return ids
+}
@@ -0,0 +1,394 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testRules returns fixed rules for tests so they do not depend on the configuration.
+func testRules() Rules {
+	r := DefaultRules()
+	r.MaxSpeed = 10
+	r.HolesEachStep = 6
+	r.HoleSpeed = 3
+	r.Torus = false
+	r.TeamSize = 0
+	return r
+}
+
+// testGame returns a game in round 3 on an empty board. The start cell of each player is marked with its id.
+func testGame(width, height int, rules Rules, players map[int]*Player) *Game {
+	g := &Game{Width: width, Height: height, Rules: rules, Players: players, Running: true, round: 3}
+	g.Cells = make([][]int8, height)
+	for y := range g.Cells {
+		g.Cells[y] = make([]int8, width)
+	}
+	for i, p := range players {
+		p.Active = true
+		g.Cells[p.Y][p.X] = int8(i)
+	}
+	return g
+}
+
+func TestIsHole(t *testing.T) {
+	g := &Game{Rules: testRules()}
+	tests := []struct {
+		name        string
+		speed       int
+		stepCounter int
+		s           int
+		want        bool
+	}{
+		{"too slow", 2, 6, 1, false},
+		{"first step", 5, 6, 0, false},
+		{"middle step", 5, 6, 2, true},
+		{"last step", 5, 6, 4, false},
+		{"not each step", 5, 7, 2, false},
+		{"second hole step", 5, 12, 1, true},
+		{"hole speed", 3, 6, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsHole(g, tt.speed, tt.stepCounter, tt.s); got != tt.want {
+				t.Errorf("IsHole(%d, %d, %d) = %v, want %v", tt.speed, tt.stepCounter, tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStepHoles(t *testing.T) {
+	tests := []struct {
+		name        string
+		speed       int
+		stepCounter int // before the step
+		want        []int8
+	}{
+		{"no hole step", 5, 4, []int8{1, 1, 1, 1, 1, 1, 0}},
+		{"hole step", 5, 5, []int8{1, 1, 0, 0, 0, 1, 0}},
+		{"hole step below hole speed", 2, 5, []int8{1, 1, 1, 0, 0, 0, 0}},
+		{"next hole step", 5, 11, []int8{1, 1, 0, 0, 0, 1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := testGame(7, 1, testRules(), map[int]*Player{1: {X: 0, Y: 0, Direction: DirectionRight, Speed: tt.speed, stepCounter: tt.stepCounter}})
+			next, events := Step(g, map[int]string{1: ActionNOOP})
+			if len(events) != 0 {
+				t.Fatalf("unexpected events %v", events)
+			}
+			if !reflect.DeepEqual(next.Cells[0], tt.want) {
+				t.Errorf("got cells %v, want %v", next.Cells[0], tt.want)
+			}
+			if next.Players[1].stepCounter != tt.stepCounter+1 {
+				t.Errorf("got step counter %d, want %d", next.Players[1].stepCounter, tt.stepCounter+1)
+			}
+			if g.Cells[0][1] != 0 || g.Players[1].X != 0 {
+				t.Error("Step modified the original game")
+			}
+		})
+	}
+}
+
+func TestStepEliminations(t *testing.T) {
+	tests := []struct {
+		name    string
+		torus   bool
+		cells   map[Position]int8 // cells filled before the step
+		players map[int]*Player
+		actions map[int]string
+		want    map[int]*Elimination // nil for players which are still active
+		pos     map[int]Position     // expected positions, only checked for the given players
+		check   map[Position]int8    // expected cells after the step
+	}{
+		{
+			name: "head-on",
+			players: map[int]*Player{
+				1: {X: 1, Y: 2, Direction: DirectionRight, Speed: 1},
+				2: {X: 3, Y: 2, Direction: DirectionLeft, Speed: 1},
+			},
+			actions: map[int]string{1: ActionNOOP, 2: ActionNOOP},
+			want: map[int]*Elimination{
+				1: {Reason: EliminationCrash, Round: 3, Opponent: 2},
+				2: {Reason: EliminationCrash, Round: 3, Opponent: 1},
+			},
+			check: map[Position]int8{{2, 2}: -1},
+		},
+		{
+			name: "head-on after turn",
+			players: map[int]*Player{
+				1: {X: 1, Y: 2, Direction: DirectionUp, Speed: 1},
+				2: {X: 2, Y: 1, Direction: DirectionRight, Speed: 1},
+				3: {X: 0, Y: 0, Direction: DirectionRight, Speed: 1},
+			},
+			actions: map[int]string{1: ActionTurnRight, 2: ActionTurnRight, 3: ActionNOOP},
+			want: map[int]*Elimination{
+				1: {Reason: EliminationCrash, Round: 3, Opponent: 2},
+				2: {Reason: EliminationCrash, Round: 3, Opponent: 1},
+				3: nil,
+			},
+			check: map[Position]int8{{2, 2}: -1, {1, 0}: 3},
+		},
+		{
+			name:  "trail of opponent",
+			cells: map[Position]int8{{2, 2}: 2},
+			players: map[int]*Player{
+				1: {X: 0, Y: 2, Direction: DirectionRight, Speed: 3},
+				2: {X: 4, Y: 4, Direction: DirectionUp, Speed: 1},
+			},
+			actions: map[int]string{1: ActionNOOP, 2: ActionNOOP},
+			want: map[int]*Elimination{
+				1: {Reason: EliminationCrash, Round: 3, Opponent: 2},
+				2: nil,
+			},
+		},
+		{
+			name:  "own trail",
+			cells: map[Position]int8{{2, 2}: 1},
+			players: map[int]*Player{
+				1: {X: 0, Y: 2, Direction: DirectionRight, Speed: 2},
+			},
+			actions: map[int]string{1: ActionNOOP},
+			want:    map[int]*Elimination{1: {Reason: EliminationCrash, Round: 3}},
+		},
+		{
+			name:  "obstacle",
+			cells: map[Position]int8{{2, 2}: CellObstacle},
+			players: map[int]*Player{
+				1: {X: 0, Y: 2, Direction: DirectionRight, Speed: 2},
+			},
+			actions: map[int]string{1: ActionNOOP},
+			want:    map[int]*Elimination{1: {Reason: EliminationCrash, Round: 3}},
+		},
+		{
+			name:  "jump over trail",
+			cells: map[Position]int8{{2, 2}: 2},
+			players: map[int]*Player{
+				1: {X: 0, Y: 2, Direction: DirectionRight, Speed: 3, stepCounter: 5},
+				2: {X: 4, Y: 4, Direction: DirectionUp, Speed: 1},
+			},
+			actions: map[int]string{1: ActionNOOP, 2: ActionNOOP},
+			want:    map[int]*Elimination{1: nil, 2: nil},
+			pos:     map[int]Position{1: {3, 2}},
+			check:   map[Position]int8{{1, 2}: 1, {2, 2}: 2, {3, 2}: 1},
+		},
+		{
+			name: "left board",
+			players: map[int]*Player{
+				1: {X: 0, Y: 2, Direction: DirectionLeft, Speed: 1},
+			},
+			actions: map[int]string{1: ActionNOOP},
+			want:    map[int]*Elimination{1: {Reason: EliminationLeftBoard, Round: 3}},
+		},
+		{
+			name:  "torus wrap",
+			torus: true,
+			players: map[int]*Player{
+				1: {X: 0, Y: 2, Direction: DirectionLeft, Speed: 2},
+				2: {X: 2, Y: 0, Direction: DirectionUp, Speed: 1},
+			},
+			actions: map[int]string{1: ActionNOOP, 2: ActionNOOP},
+			want:    map[int]*Elimination{1: nil, 2: nil},
+			pos:     map[int]Position{1: {3, 2}, 2: {2, 4}},
+			check:   map[Position]int8{{4, 2}: 1, {3, 2}: 1, {2, 4}: 2},
+		},
+		{
+			name:  "torus wrap into trail",
+			torus: true,
+			cells: map[Position]int8{{4, 2}: 2},
+			players: map[int]*Player{
+				1: {X: 0, Y: 2, Direction: DirectionLeft, Speed: 1},
+				2: {X: 2, Y: 0, Direction: DirectionDown, Speed: 1},
+			},
+			actions: map[int]string{1: ActionNOOP, 2: ActionNOOP},
+			want: map[int]*Elimination{
+				1: {Reason: EliminationCrash, Round: 3, Opponent: 2},
+				2: nil,
+			},
+		},
+		{
+			name:  "torus head-on across edge",
+			torus: true,
+			players: map[int]*Player{
+				1: {X: 0, Y: 2, Direction: DirectionLeft, Speed: 1},
+				2: {X: 3, Y: 2, Direction: DirectionRight, Speed: 1},
+			},
+			actions: map[int]string{1: ActionNOOP, 2: ActionNOOP},
+			want: map[int]*Elimination{
+				1: {Reason: EliminationCrash, Round: 3, Opponent: 2},
+				2: {Reason: EliminationCrash, Round: 3, Opponent: 1},
+			},
+			check: map[Position]int8{{4, 2}: -1},
+		},
+		{
+			name: "invalid actions",
+			players: map[int]*Player{
+				1: {X: 0, Y: 0, Direction: DirectionRight, Speed: 1},
+				2: {X: 0, Y: 1, Direction: DirectionRight, Speed: 1},
+				3: {X: 0, Y: 2, Direction: DirectionRight, Speed: 10},
+				4: {X: 0, Y: 3, Direction: DirectionRight, Speed: 1},
+			},
+			actions: map[int]string{2: "jump", 3: ActionFaster, 4: ActionSlower},
+			want: map[int]*Elimination{
+				1: {Reason: EliminationTimeout, Round: 3},
+				2: {Reason: EliminationInvalidAnswer, Round: 3},
+				3: {Reason: EliminationTooFast, Round: 3},
+				4: {Reason: EliminationTooSlow, Round: 3},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRules()
+			r.Torus = tt.torus
+			g := testGame(5, 5, r, tt.players)
+			for c, v := range tt.cells {
+				g.Cells[c.Y][c.X] = v
+			}
+			next, events := Step(g, tt.actions)
+
+			eliminated := 0
+			for i, want := range tt.want {
+				p := next.Players[i]
+				if want == nil {
+					if !p.Active || p.Elimination != nil {
+						t.Errorf("player %d: got eliminated (%+v), want active", i, p.Elimination)
+					}
+					continue
+				}
+				eliminated++
+				if p.Active || p.Elimination == nil || *p.Elimination != *want {
+					t.Errorf("player %d: got elimination %+v (active %v), want %+v", i, p.Elimination, p.Active, *want)
+				}
+			}
+			if len(events) != eliminated {
+				t.Errorf("got %d events, want %d: %+v", len(events), eliminated, events)
+			}
+			for _, e := range events {
+				want := tt.want[e.Player]
+				if e.Type != EventEliminated || want == nil || e.Reason != want.Reason || e.Opponent != want.Opponent || e.Round != want.Round {
+					t.Errorf("unexpected event %+v", e)
+				}
+			}
+			for i, want := range tt.pos {
+				if got := (Position{next.Players[i].X, next.Players[i].Y}); got != want {
+					t.Errorf("player %d: got position %v, want %v", i, got, want)
+				}
+			}
+			for c, want := range tt.check {
+				if got := next.Cells[c.Y][c.X]; got != want {
+					t.Errorf("cell %v: got %d, want %d", c, got, want)
+				}
+			}
+			if next.round != g.round+1 {
+				t.Errorf("got round %d, want %d", next.round, g.round+1)
+			}
+		})
+	}
+}
+
+func TestRanking(t *testing.T) {
+	eliminated := func(round int) *Player {
+		return &Player{Elimination: &Elimination{Reason: EliminationCrash, Round: round}}
+	}
+	tests := []struct {
+		name    string
+		players map[int]*Player
+		want    []Placement
+		winner  int
+	}{
+		{
+			name:    "single winner",
+			players: map[int]*Player{1: eliminated(4), 2: {Active: true}, 3: eliminated(2)},
+			want:    []Placement{{2, 1}, {1, 2}, {3, 3}},
+			winner:  2,
+		},
+		{
+			name:    "tie in same round",
+			players: map[int]*Player{1: {Active: true}, 2: eliminated(5), 3: eliminated(5), 4: eliminated(3)},
+			want:    []Placement{{1, 1}, {2, 2}, {3, 2}, {4, 4}},
+			winner:  1,
+		},
+		{
+			name:    "draw",
+			players: map[int]*Player{1: eliminated(7), 2: eliminated(7), 3: eliminated(1)},
+			want:    []Placement{{1, 1}, {2, 1}, {3, 3}},
+			winner:  -1,
+		},
+		{
+			name:    "missing elimination",
+			players: map[int]*Player{1: eliminated(1), 2: {}},
+			want:    []Placement{{1, 1}, {2, 2}},
+			winner:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &Game{Players: tt.players}
+			got := Ranking(g)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got ranking %v, want %v", got, tt.want)
+			}
+			if w := Winner(got); w != tt.winner {
+				t.Errorf("got winner %d, want %d", w, tt.winner)
+			}
+		})
+	}
+}
+
+func TestTeamRanking(t *testing.T) {
+	player := func(team, round int) *Player {
+		if round == 0 {
+			return &Player{Team: team, Active: true}
+		}
+		return &Player{Team: team, Elimination: &Elimination{Reason: EliminationCrash, Round: round}}
+	}
+	tests := []struct {
+		name     string
+		teamSize int
+		players  map[int]*Player
+		want     []Placement
+	}{
+		{
+			name:     "no teams",
+			teamSize: 1,
+			players:  map[int]*Player{1: player(0, 0), 2: player(0, 1)},
+			want:     nil,
+		},
+		{
+			name:     "best player counts",
+			teamSize: 2,
+			players:  map[int]*Player{1: player(1, 2), 2: player(2, 5), 3: player(1, 0), 4: player(2, 1)},
+			want:     []Placement{{1, 1}, {2, 2}},
+		},
+		{
+			name:     "tie",
+			teamSize: 2,
+			players:  map[int]*Player{1: player(1, 4), 2: player(2, 4), 3: player(1, 1), 4: player(2, 2), 5: player(3, 1), 6: player(3, 1)},
+			want:     []Placement{{1, 1}, {2, 1}, {3, 3}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRules()
+			r.TeamSize = tt.teamSize
+			got := TeamRanking(&Game{Rules: r, Players: tt.players})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got team ranking %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -17,21 +17,27 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/rand"
+	"reflect"
 	"sync"
 	"time"
 )
 
 const (
+	// MaxPlayersPerGame contains the upper limit for PlayersPerGame. It is limited by the values a cell can hold.
+	MaxPlayersPerGame = 127
+)
+
+// The following values are the default rules of new games (see DefaultRules).
+// They can be changed by the configuration (see ValidateSettings), but must not be changed while games are running.
+var (
 	// FieldMaxSize contains the maximum size of the field (both width and height).
 	FieldMaxSize = 80
 	// FieldMinSize contains the minimum size of the field (both width and height).
 	FieldMinSize = 40
-	// PlayersPerGame contains the maximum number of players allowed in the game.
-	// DO NOT CHANGE if you are not absolutely sure to know what side effects this has.
-	PlayersPerGame = 6
 	// MaxSpeed holds the maximum speed.
 	MaxSpeed = 10
 	// HolesEachStep holds after how many steps a hole might occur (if the preconditions are met).
@@ -44,43 +50,155 @@ const (
 	RoundTimeoutGrace = 2
 	// HoleSpeed contains the minimum speed needed for a hole.
 	HoleSpeed = 3
+	// Torus holds whether the board wraps around at its edges.
+	Torus = false
+	// MapName holds the map of all games (see Rules.Map).
+	MapName = ""
+	// ObstacleDensity holds the percentage of cells covered by generated obstacles.
+	ObstacleDensity = 0
+	// SuddenDeathRound holds the number of rounds after which sudden death starts. 0 disables sudden death.
+	SuddenDeathRound = 0
+	// SuddenDeathMode holds how cells are filled during sudden death (SuddenDeathRing or SuddenDeathBlocks).
+	SuddenDeathMode = SuddenDeathRing
+	// SuddenDeathInterval holds after how many rounds cells are filled during sudden death.
+	SuddenDeathInterval = 1
+	// TeamSize holds the number of players per team. 0 or 1 means that every player plays alone.
+	TeamSize = 0
+	// TrainingTimeoutMin has the minimum time a round of a training game has (in milliseconds).
+	TrainingTimeoutMin = 100
+	// TrainingTimeoutMax has the maximum time a round of a training game has (in milliseconds).
+	TrainingTimeoutMax = 500
+	// TrainingTimeoutGrace has the grace period of training games (in milliseconds), see RoundTimeoutGrace.
+	TrainingTimeoutGrace = 50
 )
 
+// PlayersPerGame contains the maximum number of players allowed in the game.
+// Must be between 2 and MaxPlayersPerGame. Must not be changed while games are running.
+var PlayersPerGame = 6
+
 var (
 	// ErrFullGame is returned when a player is added despite having a full game.
 	ErrFullGame = errors.New("full game")
+	// ErrFullTeam is returned when a player is added to a team which is already full or no further team fits into the game.
+	ErrFullTeam = errors.New("full team")
 )
 
 // Game represents a game of speed. See https://github.com/informatiCup/InformatiCup2021/ for a description of the game.
 type Game struct {
-	Width    int             `json:"width"`
-	Height   int             `json:"height"`
-	Cells    [][]int8        `json:"cells"`
-	Players  map[int]*Player `json:"players"`
-	You      int             `json:"you"` // only needed for protocol, ignored everywhere else
-	Running  bool            `json:"running"`
-	Deadline string          `json:"deadline,omitempty"` // RFC3339
-
-	l   sync.Mutex
-	log *Logger
+	Width       int             `json:"width"`
+	Height      int             `json:"height"`
+	Cells       [][]int8        `json:"cells"`
+	Players     map[int]*Player `json:"players"`
+	You         int             `json:"you"` // only needed for protocol, ignored everywhere else
+	Running     bool            `json:"running"`
+	Deadline    string          `json:"deadline,omitempty"`    // RFC3339
+	Ranking     []Placement     `json:"ranking,omitempty"`     // only set after the game has finished
+	TeamRanking []Placement     `json:"teamRanking,omitempty"` // only set after the game has finished if it is played in teams, Placement.Player holds the team
+	Rules       Rules           `json:"rules"`
+	NewCells    []Position      `json:"newCells,omitempty"` // cells filled by sudden death since the last state
+
+	l     sync.Mutex
+	log   *Logger
+	watch *WatchedGame
+
+	// Seed contains the seed of all random decisions of the game. 0 means that a random seed is chosen.
+	Seed int64 `json:"-"`
+	rng  *rand.Rand
+
+	// Practice marks games requested by a single player against chosen AIs. Practice games are not counted in rankings.
+	Practice bool `json:"-"`
 
 	MaxPlayer     int `json:"-"`
+	minPlayer     int // lower limit for MaxPlayer, 2 if not set
+	maxPlayer     int // upper limit for MaxPlayer, PlayersPerGame if not set
 	numberPlayer  int
+	round         int // current round, starting at 1
 	playerAnswer  []string
 	playerChannel []chan string
 }
 
+// NewGame returns a new game using the given seed. If seed is 0, a random seed is chosen.
+// The number of players is chosen randomly between minPlayer and maxPlayer (both inclusive).
+// The game uses the default rules (see DefaultRules), Rules can be changed until the game is started.
+func NewGame(seed int64, minPlayer, maxPlayer int) *Game {
+	g := new(Game)
+	g.Seed = seed
+	g.Rules = DefaultRules()
+	g.minPlayer = minPlayer
+	g.maxPlayer = maxPlayer
+	g.initRandom()
+	return g
+}
+
+// NewPracticeGame returns a new practice game against the AIs with the given names (see GetAINames) with exactly one free place.
+// Practice games are limited to PlayersPerGame players like regular games.
+// The game should be started as soon as the player is added.
+func NewPracticeGame(ais []string) (*Game, error) {
+	if len(ais) == 0 || len(ais) >= PlayersPerGame {
+		return nil, fmt.Errorf("number of ais must be between 1 and %d", PlayersPerGame-1)
+	}
+	g := NewGame(0, len(ais)+1, len(ais)+1)
+	g.Practice = true
+	err := g.Rules.ValidateGame(len(ais) + 1)
+	if err != nil {
+		return nil, err
+	}
+	err = g.AddNamedAI(ais)
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// NewTrainingGame returns a new practice game (see NewPracticeGame) using the training rules (see TrainingRules).
+// The number of AIs is limited like in practice games.
+func NewTrainingGame(ais []string) (*Game, error) {
+	g, err := NewPracticeGame(ais)
+	if err != nil {
+		return nil, err
+	}
+	g.Rules = TrainingRules()
+	err = g.Rules.ValidateGame(len(ais) + 1)
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
 // AddPlayer adds a player to the game. Will return ErrFullGame instead if game is full.
 func (g *Game) AddPlayer(p *Player) error {
 	g.l.Lock()
 	defer g.l.Unlock()
 
+	return g.addPlayer(p)
+}
+
+// addPlayer adds a player to the game. Will return ErrFullGame instead if game is full.
+// Caller has to lock the game.
+func (g *Game) addPlayer(p *Player) error {
 	g.setMaxPlayer()
 
 	if g.numberPlayer == g.MaxPlayer {
 		return ErrFullGame
 	}
 
+	if g.Rules.TeamSize > 1 && p.teamName != "" {
+		members := 0
+		teams := make(map[string]bool)
+		for _, other := range g.Players {
+			if other.teamName == "" {
+				continue
+			}
+			teams[other.teamName] = true
+			if other.teamName == p.teamName {
+				members++
+			}
+		}
+		if members >= g.Rules.TeamSize || (!teams[p.teamName] && len(teams) >= g.MaxPlayer/g.Rules.TeamSize) {
+			return ErrFullTeam
+		}
+	}
+
 	if g.Players == nil {
 		g.Players = make(map[int]*Player)
 	}
@@ -91,6 +209,71 @@ func (g *Game) AddPlayer(p *Player) error {
 	return nil
 }
 
+// RemovePlayer removes a player from a game which has not been started yet. It returns false if the player is not part of the game.
+// The player is not closed.
+func (g *Game) RemovePlayer(p *Player) bool {
+	g.l.Lock()
+	defer g.l.Unlock()
+
+	for k := range g.Players {
+		if g.Players[k] != p {
+			continue
+		}
+		// Keep the player numbers continuous
+		g.Players[k] = g.Players[g.numberPlayer]
+		delete(g.Players, g.numberPlayer)
+		g.numberPlayer--
+		return true
+	}
+	return false
+}
+
+// FillAI fills all free places of the game with AIs out of the current rotation.
+func (g *Game) FillAI() {
+	g.l.Lock()
+	defer g.l.Unlock()
+
+	g.setMaxPlayer()
+
+	g.addAI(GetAI(g.MaxPlayer-g.numberPlayer, g.rng))
+}
+
+// AddNamedAI adds AIs with the given names (as registered with RegisterAI) to the game.
+// If an error is returned, no AI was added.
+func (g *Game) AddNamedAI(names []string) error {
+	g.l.Lock()
+	defer g.l.Unlock()
+
+	g.setMaxPlayer()
+
+	if g.MaxPlayer-g.numberPlayer < len(names) {
+		return ErrFullGame
+	}
+
+	ais, err := GetNamedAI(names, g.rng)
+	if err != nil {
+		return err
+	}
+	g.addAI(ais)
+	return nil
+}
+
+// addAI adds the AIs as players to the game.
+// Caller has to lock the game.
+func (g *Game) addAI(ais []NewAI) {
+	for i := range ais {
+		p := new(Player)
+		p.realName = ais[i].API
+		p.underlyingAI = ais[i].AI
+		p.Input = make(chan string, 5)
+		p.underlyingAI.GetChannel(p.Input)
+		err := g.addPlayer(p)
+		if err != nil {
+			log.Println("game:", "adding ai:", err)
+		}
+	}
+}
+
 // IsReady returns if the game is ready to start.
 func (g *Game) IsReady() bool {
 	g.l.Lock()
@@ -102,8 +285,8 @@ func (g *Game) IsReady() bool {
 }
 
 // RunGame will (completely) run a game. You have to make sure that IsReady returns true before calling this method.
-// It will return the winning player or -1 for a draw. If errors occur, this value is undefined.
-func (g *Game) RunGame() (int, error) {
+// It will return the final ranking of all players (see Ranking). If errors occur, this value is undefined.
+func (g *Game) RunGame() ([]Placement, error) {
 	g.l.Lock()
 	defer g.l.Unlock()
 
@@ -111,109 +294,75 @@ func (g *Game) RunGame() (int, error) {
 	var gameID string
 	var statLock sync.Mutex
 
+	g.setMaxPlayer()
+
 	g.log, gameID, err = GetLogger()
-	log.Println("game:", "starting", gameID)
+	if g.Rules.Training {
+		log.Println("game:", "starting", gameID, "- seed", g.Seed, "- training")
+	} else if g.Practice {
+		log.Println("game:", "starting", gameID, "- seed", g.Seed, "- practice")
+	} else {
+		log.Println("game:", "starting", gameID, "- seed", g.Seed)
+	}
 
 	if err != nil {
 		log.Println("getting logger:", err)
 	}
 	if g.log != nil {
 		defer g.log.Close()
-		g.log.LogPlayer(g.Players)
 	}
 
-	g.setMaxPlayer()
-
 	// Check player
 	if g.numberPlayer != g.MaxPlayer {
-		return -100, errors.New("not enough player")
+		return nil, errors.New("not enough player")
 	}
 
 	// Initialise
-	//// Initialise board
-	g.Width = rand.Intn(FieldMaxSize-FieldMinSize) + FieldMinSize + 1
-	g.Height = rand.Intn(FieldMaxSize-FieldMinSize) + FieldMinSize + 1
-
-	g.Cells = make([][]int8, g.Height)
-	for i := range g.Cells {
-		g.Cells[i] = make([]int8, g.Width)
+	g.initialise()
+	if g.log != nil {
+		g.log.LogStart(g)
 	}
 
-	//// Initialise players
-	// Quadrantenphysik
-	quarterSelect := []int{0, 1, 2, 3, 4, 5, 6, 7}
-	rand.Shuffle(len(quarterSelect), func(i, j int) { quarterSelect[j], quarterSelect[i] = quarterSelect[i], quarterSelect[j] })
-
-	quarterWidth := g.Width / 4
-	quarterHeight := g.Height / 2
-
-	quarterNum := 0
-	for i := range g.Players {
-		g.Players[i].Speed = 1
-		g.Players[i].Active = true
-		x := 0
-		y := 0
-		switch quarterNum {
-		case 0:
-			x = 0
-			y = 0
-		case 1:
-			x = quarterWidth
-			y = 0
-		case 2:
-			x = quarterWidth * 2
-			y = 0
-		case 3:
-			x = quarterWidth * 3
-			y = 0
-		case 4:
-			x = 0
-			y = quarterHeight
-		case 5:
-			x = quarterWidth
-			y = quarterHeight
-		case 6:
-			x = quarterWidth * 2
-			y = quarterHeight
-		case 7:
-			x = quarterWidth
-			y = quarterHeight * 3
-		}
-		g.Players[i].X = x + rand.Intn(quarterWidth)
-		g.Players[i].Y = y + rand.Intn(quarterHeight)
-
-		g.Cells[g.Players[i].Y][g.Players[i].X] = int8(i)
+	if watchEnabled {
+		g.watch = NewWatchedGame(WatchInfo{ID: gameID, Start: time.Now(), Players: g.numberPlayer, Width: g.Width, Height: g.Height})
+		defer g.watch.Close()
+	}
 
-		switch {
-		case g.Players[i].X > g.Width/2 && g.Players[i].Y > g.Height/2:
-			g.Players[i].Direction = DirectionUp
-		case g.Players[i].X <= g.Width/2 && g.Players[i].Y > g.Height/2:
-			g.Players[i].Direction = DirectionRight
-		case g.Players[i].X > g.Width/2 && g.Players[i].Y <= g.Height/2:
-			g.Players[i].Direction = DirectionLeft
-		case g.Players[i].X <= g.Width/2 && g.Players[i].Y <= g.Height/2:
-			g.Players[i].Direction = DirectionDown
-		default:
-			// Just give some direction
-			g.Players[i].Direction = DirectionUp
+	// Send stats
+	var gs GameStats
+	sendStats := func() {
+		// Send a copy since the worker might read it concurrently
+		c := GameStats{Key: gs.Key, Start: gs.Start, Practice: gs.Practice, Players: make(map[int]PlayerStats, len(gs.Players))}
+		for k, v := range gs.Players {
+			c.Players[k] = v
 		}
-
-		quarterNum++
+		statLock.Lock()
+		go func() {
+			SendStat <- c
+			statLock.Unlock()
+		}()
 	}
-
-	//// Initialise game
-	g.playerChannel = make([]chan string, PlayersPerGame)
-	for i := 1; i <= g.numberPlayer; i++ {
-		g.playerChannel[i-1] = g.Players[i].Input // Used for communicating later
+	updateStats := func() {
+		changed := false
+		for i := range gs.Players {
+			ps := gs.Players[i]
+			if ps.Elimination == nil && g.Players[i].Elimination != nil {
+				ps.Elimination = g.Players[i].Elimination
+				gs.Players[i] = ps
+				changed = true
+			}
+		}
+		if changed {
+			sendStats()
+		}
 	}
-	g.Running = true
 
-	// Send stats
 	if statsEnabled {
-		gs := GameStats{
-			Key:     gameID,
-			Start:   time.Now(),
-			Players: make(map[int]PlayerStats),
+		gs = GameStats{
+			Key:      gameID,
+			Start:    time.Now(),
+			Practice: g.Practice,
+			Players:  make(map[int]PlayerStats),
 		}
 		for i := range g.Players {
 			ps := PlayerStats{
@@ -224,234 +373,73 @@ func (g *Game) RunGame() (int, error) {
 				ps.Key = g.Players[i].underlyingAI.Name()
 				ps.Bot = true
 			} else {
-				ps.Key = g.Players[i].api
+				ps.Key = KeyFingerprint(g.Players[i].api)
 				ps.Bot = false
 				go func() { DeleteLobby <- ps.Key }()
 			}
+			ps.Team = g.Players[i].Team
 			gs.Players[i] = ps
 		}
-		statLock.Lock()
-		go func() {
-			SendStat <- gs
-			statLock.Unlock()
-		}()
+		sendStats()
 	}
 
 	// Run game
 
 mainGame:
 	for { // Loop used for rounds
-		timeout := rand.Intn(RoundTimeoutMax-RoundTimeoutMin+1) + RoundTimeoutMin
-		deadline := time.Now().Add(time.Duration(timeout) * time.Second).UTC()
-		g.Deadline = deadline.Format(time.RFC3339)
+		timeout := g.rng.Intn(g.Rules.RoundTimeoutMax-g.Rules.RoundTimeoutMin+1) + g.Rules.RoundTimeoutMin
+		deadline := time.Now().Add(time.Duration(timeout) * g.Rules.TimeoutUnit()).UTC()
+		g.Deadline = deadline.Format(g.Rules.DeadlineFormat())
 		g.sendState()
-		deadline = deadline.Add(time.Duration(RoundTimeoutGrace) * time.Second)
+		sent := time.Now()
+		g.log.StartRound(g)
+		deadline = deadline.Add(time.Duration(g.Rules.RoundTimeoutGrace) * g.Rules.TimeoutUnit())
 		ctx, cancel := context.WithDeadline(context.Background(), deadline)
-		g.playerAnswer = make([]string, PlayersPerGame)
+		g.playerAnswer = make([]string, g.numberPlayer)
+		cases := make([]reflect.SelectCase, len(g.playerChannel)+1)
 	innerGame:
 		for { // Loop used for input
-			select { // IMPORTANT: This has to be changed when the number of player changes
-			// 1
-			case a, ok := <-g.playerChannel[1-1]:
-				player := 1
-				if !ok {
-					g.invalidatePlayer(player)
-				} else if a == "" || g.playerAnswer[player-1] != "" || !IsValidAction(a) {
-					log.Printf("Invalid answer from %s (%s)", g.Players[player].api, a)
-					g.invalidatePlayer(player)
-				} else {
-					g.playerAnswer[player-1] = a
-				}
-				if g.checkEndRound() {
-					break innerGame
-				}
-			// 2
-			case a, ok := <-g.playerChannel[2-1]:
-				player := 2
-				if !ok {
-					g.invalidatePlayer(player)
-				} else if a == "" || g.playerAnswer[player-1] != "" || !IsValidAction(a) {
-					log.Printf("Invalid answer from %s (%s)", g.Players[player].api, a)
-					g.invalidatePlayer(player)
-				} else {
-					g.playerAnswer[player-1] = a
-				}
-				if g.checkEndRound() {
-					break innerGame
-				}
-			// 3
-			case a, ok := <-g.playerChannel[3-1]:
-				player := 3
-				if !ok {
-					g.invalidatePlayer(player)
-				} else if a == "" || g.playerAnswer[player-1] != "" || !IsValidAction(a) {
-					log.Printf("Invalid answer from %s (%s)", g.Players[player].api, a)
-					g.invalidatePlayer(player)
-				} else {
-					g.playerAnswer[player-1] = a
-				}
-				if g.checkEndRound() {
-					break innerGame
-				}
-			// 4
-			case a, ok := <-g.playerChannel[4-1]:
-				player := 4
-				if !ok {
-					g.invalidatePlayer(player)
-				} else if a == "" || g.playerAnswer[player-1] != "" || !IsValidAction(a) {
-					log.Printf("Invalid answer from %s (%s)", g.Players[player].api, a)
-					g.invalidatePlayer(player)
-				} else {
-					g.playerAnswer[player-1] = a
-				}
-				if g.checkEndRound() {
-					break innerGame
-				}
-			// 5
-			case a, ok := <-g.playerChannel[5-1]:
-				player := 5
-				if !ok {
-					g.invalidatePlayer(player)
-				} else if a == "" || g.playerAnswer[player-1] != "" || !IsValidAction(a) {
-					log.Printf("Invalid answer from %s (%s)", g.Players[player].api, a)
-					g.invalidatePlayer(player)
-				} else {
-					g.playerAnswer[player-1] = a
-				}
-				if g.checkEndRound() {
-					break innerGame
-				}
-			// 6
-			case a, ok := <-g.playerChannel[6-1]:
-				player := 6
-				if !ok {
-					g.invalidatePlayer(player)
-				} else if a == "" || g.playerAnswer[player-1] != "" || !IsValidAction(a) {
-					log.Printf("Invalid answer from %s (%s)", g.Players[player].api, a)
-					g.invalidatePlayer(player)
+			// Case 0 is the deadline, case i is player i
+			cases[0] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}
+			for i := range g.playerChannel {
+				cases[i+1] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(g.playerChannel[i])}
+			}
+
+			player, value, ok := reflect.Select(cases)
+			if player == 0 {
+				break innerGame
+			}
+			if !ok {
+				g.invalidatePlayer(player, Elimination{Reason: EliminationDisconnected, Round: g.round})
+			} else {
+				a := value.String()
+				g.log.LogAction(player, a, time.Since(sent))
+				if g.playerAnswer[player-1] != "" {
+					log.Printf("Duplicate answer from %s (%s)", KeyFingerprint(g.Players[player].api), a)
+					g.invalidatePlayer(player, Elimination{Reason: EliminationDuplicateAnswer, Round: g.round})
+				} else if a == "" || !IsValidAction(a) {
+					log.Printf("Invalid answer from %s (%s)", KeyFingerprint(g.Players[player].api), a)
+					g.invalidatePlayer(player, Elimination{Reason: EliminationInvalidAnswer, Round: g.round})
 				} else {
 					g.playerAnswer[player-1] = a
 				}
-				if g.checkEndRound() {
-					break innerGame
-				}
-			case <-ctx.Done():
+			}
+			if g.checkEndRound() {
 				break innerGame
 			}
 		}
 		cancel()
 
-		// Process Actions
-		for i := range g.Players {
-			switch g.playerAnswer[i-1] {
-			case "":
-				g.invalidatePlayer(i)
-			case ActionTurnLeft:
-				switch g.Players[i].Direction {
-				case DirectionLeft:
-					g.Players[i].Direction = DirectionDown
-				case DirectionRight:
-					g.Players[i].Direction = DirectionUp
-				case DirectionUp:
-					g.Players[i].Direction = DirectionLeft
-				case DirectionDown:
-					g.Players[i].Direction = DirectionRight
-				}
-			case ActionTurnRight:
-				switch g.Players[i].Direction {
-				case DirectionLeft:
-					g.Players[i].Direction = DirectionUp
-				case DirectionRight:
-					g.Players[i].Direction = DirectionDown
-				case DirectionUp:
-					g.Players[i].Direction = DirectionRight
-				case DirectionDown:
-					g.Players[i].Direction = DirectionLeft
-				}
-			case ActionFaster:
-				g.Players[i].Speed++
-				if g.Players[i].Speed > MaxSpeed {
-					g.invalidatePlayer(i)
-				}
-			case ActionSlower:
-				g.Players[i].Speed--
-				if g.Players[i].Speed < 1 {
-					g.invalidatePlayer(i)
-				}
-			case ActionNOOP:
-				// Do nothing
-			default:
-				g.invalidatePlayer(i)
-			}
-		}
-
-		// Do Movement
+		// Compute round
+		actions := make(map[int]string, len(g.Players))
 		for i := range g.Players {
-			if !g.Players[i].Active {
-				continue
-			}
-			var dostep func(x, y int) (int, int)
-			switch g.Players[i].Direction {
-			case DirectionUp:
-				dostep = func(x, y int) (int, int) { return x, y - 1 }
-			case DirectionDown:
-				dostep = func(x, y int) (int, int) { return x, y + 1 }
-			case DirectionLeft:
-				dostep = func(x, y int) (int, int) { return x - 1, y }
-			case DirectionRight:
-				dostep = func(x, y int) (int, int) { return x + 1, y }
-			}
-
-			g.Players[i].stepCounter++
-
-			for s := 0; s < g.Players[i].Speed; s++ {
-				g.Players[i].X, g.Players[i].Y = dostep(g.Players[i].X, g.Players[i].Y)
-				if g.Players[i].X < 0 || g.Players[i].X >= g.Width || g.Players[i].Y < 0 || g.Players[i].Y >= g.Height {
-					g.invalidatePlayer(i)
-					break
-				}
-				if g.Players[i].Speed >= HoleSpeed && g.Players[i].stepCounter%HolesEachStep == 0 && s != 0 && s != g.Players[i].Speed-1 {
-					continue
-				}
-				if g.Cells[g.Players[i].Y][g.Players[i].X] != 0 {
-					g.Cells[g.Players[i].Y][g.Players[i].X] = -1
-				} else {
-					g.Cells[g.Players[i].Y][g.Players[i].X] = int8(i)
-				}
-			}
+			actions[i] = g.playerAnswer[i-1]
 		}
+		g.computeRound(actions)
+		g.log.EndRound(g)
 
-		// Check crash
-		for i := range g.Players {
-			if !g.Players[i].Active {
-				continue
-			}
-			var dostepback func(x, y int) (int, int)
-			switch g.Players[i].Direction {
-			case DirectionUp:
-				dostepback = func(x, y int) (int, int) { return x, y + 1 }
-			case DirectionDown:
-				dostepback = func(x, y int) (int, int) { return x, y - 1 }
-			case DirectionLeft:
-				dostepback = func(x, y int) (int, int) { return x + 1, y }
-			case DirectionRight:
-				dostepback = func(x, y int) (int, int) { return x - 1, y }
-			}
-
-			backX := g.Players[i].X
-			backY := g.Players[i].Y
-			for s := 0; s < g.Players[i].Speed; s++ {
-				if g.Cells[backY][backX] == -1 {
-					// Crash - check hole
-					if g.Players[i].Speed >= HoleSpeed && g.Players[i].stepCounter%HolesEachStep == 0 && s != 0 && s != g.Players[i].Speed-1 {
-						// No crash - is hole
-					} else {
-						g.invalidatePlayer(i)
-						break
-					}
-				}
-				backX, backY = dostepback(backX, backY)
-			}
+		if statsEnabled {
+			updateStats()
 		}
 
 		// Check end game
@@ -460,29 +448,39 @@ mainGame:
 		}
 	}
 	// Finish game
-	g.Running = false
-
 	for i := range g.Players {
 		g.Players[i].RevealName()
 	}
 
-	g.Deadline = ""
+	g.finish()
 	g.sendState()
 
-	winner := -1
-	for i := range g.Players {
-		if g.Players[i].Active {
-			winner = i
-			break
-		}
-	}
+	winner := Winner(g.Ranking)
 
 	winnerString := "none"
-	if winner != -1 {
+	if g.TeamRanking != nil {
+		if team := Winner(g.TeamRanking); team != -1 {
+			winnerString = fmt.Sprintf("#Team#-%d", team)
+		}
+	} else if winner != -1 {
 		if g.Players[winner].underlyingAI != nil {
 			winnerString = fmt.Sprintf("#AI#-%s", g.Players[winner].underlyingAI.Name())
 		} else {
-			winnerString = fmt.Sprintf("#Player#-%s", g.Players[winner].api)
+			winnerString = fmt.Sprintf("#Player#-%s", KeyFingerprint(g.Players[winner].api))
+		}
+	}
+
+	// Collect the results before closing the players, since closing removes the AIs
+	var ratingResults []RatingResult
+	if !g.Practice {
+		ratingResults = make([]RatingResult, 0, len(g.Ranking))
+		for _, r := range g.PlayerPlaces() {
+			p := g.Players[r.Player]
+			if p.underlyingAI != nil {
+				ratingResults = append(ratingResults, RatingResult{Name: p.underlyingAI.Name(), AI: true, Place: r.Place})
+			} else {
+				ratingResults = append(ratingResults, RatingResult{Name: KeyFingerprint(p.api), AI: false, Place: r.Place})
+			}
 		}
 	}
 
@@ -493,7 +491,16 @@ mainGame:
 		}
 	}
 
-	log.Println("game:", "ending", gameID, "- winner", winnerString)
+	if g.TeamRanking != nil {
+		log.Println("game:", "ending", gameID, "- winner", winnerString, "- ranking", g.Ranking, "- team ranking", g.TeamRanking)
+	} else {
+		log.Println("game:", "ending", gameID, "- winner", winnerString, "- ranking", g.Ranking)
+	}
+
+	if !g.Practice {
+		GlobalRatings.Update(ratingResults)
+		StoreResult(GameResult{ID: gameID, End: time.Now(), Players: ratingResults, Teams: g.TeamRanking != nil})
+	}
 
 	// Delete stats
 	if statsEnabled {
@@ -504,7 +511,90 @@ mainGame:
 		}()
 	}
 
-	return winner, nil
+	return g.Ranking, nil
+}
+
+// initialise sets up the board and the players for the first round.
+// Caller has to lock the game.
+func (g *Game) initialise() {
+	//// Initialise board
+	m := g.selectMap()
+	if m != nil {
+		g.Rules.Map = m.Name
+		g.Width = m.Width()
+		g.Height = m.Height()
+		g.Cells = m.cells()
+	} else {
+		g.Rules.Map = ""
+		g.Width = g.rng.Intn(g.Rules.FieldMaxSize-g.Rules.FieldMinSize) + g.Rules.FieldMinSize + 1
+		g.Height = g.rng.Intn(g.Rules.FieldMaxSize-g.Rules.FieldMinSize) + g.Rules.FieldMinSize + 1
+
+		g.Cells = make([][]int8, g.Height)
+		for i := range g.Cells {
+			g.Cells[i] = make([]int8, g.Width)
+		}
+	}
+
+	//// Initialise players
+	g.assignTeams()
+	if m != nil && len(m.Spawns) != 0 {
+		g.spawnFixed(m.Spawns)
+	} else {
+		g.spawnRandom()
+	}
+
+	if g.Rules.ObstacleDensity > 0 {
+		g.generateObstacles()
+	}
+
+	//// Initialise game
+	g.playerChannel = make([]chan string, g.numberPlayer)
+	for i := 1; i <= g.numberPlayer; i++ {
+		g.playerChannel[i-1] = g.Players[i].Input // Used for communicating later
+	}
+	g.Running = true
+	g.round = 1
+}
+
+// computeRound computes the next round from the actions of all players (see Step) and applies it to the game.
+// This includes eliminating players and sudden death.
+// Caller has to lock the game.
+func (g *Game) computeRound(actions map[int]string) {
+	next, events := Step(g, actions)
+	g.applyState(next)
+	for _, e := range events {
+		if e.Type == EventEliminated {
+			g.invalidatePlayer(e.Player, Elimination{Reason: e.Reason, Round: e.Round, Opponent: e.Opponent})
+		}
+	}
+	g.NewCells = SuddenDeath(g, g.rng)
+}
+
+// PlayerPlaces returns the final place of each player in the order of Ranking.
+// In team games, all players of a team get the place of their team (see TeamRanking).
+func (g *Game) PlayerPlaces() []Placement {
+	if g.TeamRanking == nil {
+		return g.Ranking
+	}
+	teamPlace := make(map[int]int, len(g.TeamRanking))
+	for _, r := range g.TeamRanking {
+		teamPlace[r.Player] = r.Place
+	}
+	places := make([]Placement, len(g.Ranking))
+	for i, r := range g.Ranking {
+		places[i] = Placement{Player: r.Player, Place: teamPlace[g.Players[r.Player].Team]}
+	}
+	return places
+}
+
+// finish marks the game as finished and computes the ranking.
+// Caller has to lock the game.
+func (g *Game) finish() {
+	g.Running = false
+	g.Deadline = ""
+	g.NewCells = nil
+	g.Ranking = Ranking(g)
+	g.TeamRanking = TeamRanking(g)
 }
 
 // sendState sends the current state to all players.
@@ -522,6 +612,15 @@ func (g *Game) sendState() {
 	if g.log != nil {
 		g.log.LogState(g)
 	}
+
+	if g.watch != nil {
+		b, err := json.Marshal(g)
+		if err != nil {
+			log.Println("game watch state:", err)
+		} else {
+			g.watch.Publish(b)
+		}
+	}
 }
 
 // checkEndRound checks whether the round has finished (all players have answered or are not active).
@@ -540,32 +639,188 @@ func (g *Game) checkEndRound() bool {
 }
 
 // checkEndGame checks whether the game has finished (only one or none players are active).
+// If the game is played in teams, the game has finished if the active players belong to at most one team.
 // Caller has to lock the game.
 func (g *Game) checkEndGame() bool {
 	numberActive := 0
+	teams := make(map[int]bool)
 	for i := range g.Players {
 		if g.Players[i].Active {
 			numberActive++
+			teams[g.Players[i].Team] = true
 		}
 	}
+	if g.Rules.TeamSize > 1 {
+		return len(teams) <= 1
+	}
 	return numberActive <= 1
 }
 
 // invalidatePlayer removes a player from participating in the game.
-// This handles setting the player inactive and removing the option to send actions.
+// This handles setting the player inactive, recording the reason of the elimination and removing the option to send actions.
+// Only the first elimination of a player is recorded.
 // Caller has to lock the game.
-func (g *Game) invalidatePlayer(p int) {
+func (g *Game) invalidatePlayer(p int, e Elimination) {
 	_, ok := g.Players[p]
 	if !ok {
 		return
 	}
 	g.Players[p].writerLock.Lock()
 	g.Players[p].Active = false
+	if g.Players[p].Elimination == nil {
+		g.Players[p].Elimination = &e
+	}
 	g.Players[p].writerLock.Unlock()
 
 	g.playerChannel[p-1] = nil
 }
 
+// applyState takes over the board and the player positions of a state computed by Step.
+// Activity of players is not changed, use invalidatePlayer instead.
+// Caller has to lock the game.
+func (g *Game) applyState(next *Game) {
+	g.round = next.round
+	g.Cells = next.Cells
+	for i := range g.Players {
+		p, ok := next.Players[i]
+		if !ok {
+			continue
+		}
+		g.Players[i].X = p.X
+		g.Players[i].Y = p.Y
+		g.Players[i].Direction = p.Direction
+		g.Players[i].Speed = p.Speed
+		g.Players[i].stepCounter = p.stepCounter
+	}
+}
+
+// assignTeams assigns all players to teams (starting at 1) if the game is played in teams.
+// Players with the same team name play in the same team. All other players fill up the teams in order of their ids, new teams are created as needed.
+// To ensure at least two teams, teams of players without a team name are limited to half of the players.
+// Caller has to lock the game.
+func (g *Game) assignTeams() {
+	if g.Rules.TeamSize < 2 {
+		return
+	}
+	size := g.Rules.TeamSize
+	if size > g.numberPlayer/2 {
+		size = g.numberPlayer / 2
+	}
+	if size < 1 {
+		size = 1
+	}
+
+	ids := playerIDs(g)
+	teams := make(map[string]int)
+	members := make(map[int]int)
+	next := 1
+	for _, i := range ids {
+		name := g.Players[i].teamName
+		if name == "" {
+			continue
+		}
+		t, ok := teams[name]
+		if !ok {
+			t = next
+			next++
+			teams[name] = t
+		}
+		g.Players[i].Team = t
+		members[t]++
+	}
+
+	t := 1
+	for _, i := range ids {
+		if g.Players[i].teamName != "" {
+			continue
+		}
+		for members[t] >= size {
+			t++
+		}
+		g.Players[i].Team = t
+		members[t]++
+	}
+}
+
+// spawnRandom places all players at random free cells and activates them.
+// Caller has to lock the game.
+func (g *Game) spawnRandom() {
+	// Quadrantenphysik - the board is divided into at least as many areas as players, each player starts in a different area.
+	areasX, areasY := spawnAreas(g.numberPlayer)
+	areaSelect := make([]int, areasX*areasY)
+	for i := range areaSelect {
+		areaSelect[i] = i
+	}
+	g.rng.Shuffle(len(areaSelect), func(i, j int) { areaSelect[j], areaSelect[i] = areaSelect[i], areaSelect[j] })
+
+	areaWidth := g.Width / areasX
+	areaHeight := g.Height / areasY
+
+	areaNum := 0
+	for _, i := range playerIDs(g) {
+		g.Players[i].Speed = 1
+		g.Players[i].Active = true
+		x := (areaSelect[areaNum] % areasX) * areaWidth
+		y := (areaSelect[areaNum] / areasX) * areaHeight
+		g.Players[i].X, g.Players[i].Y = g.freeCell(x, y, areaWidth, areaHeight)
+
+		g.Cells[g.Players[i].Y][g.Players[i].X] = int8(i)
+		g.Players[i].Direction = startDirection(g, g.Players[i].X, g.Players[i].Y)
+
+		areaNum++
+	}
+}
+
+// spawnFixed places all players at randomly selected spawn points and activates them. There must be at least as many spawn points as players.
+// Caller has to lock the game.
+func (g *Game) spawnFixed(spawns []Spawn) {
+	s := make([]Spawn, len(spawns))
+	copy(s, spawns)
+	g.rng.Shuffle(len(s), func(i, j int) { s[j], s[i] = s[i], s[j] })
+
+	for k, i := range playerIDs(g) {
+		g.Players[i].Speed = 1
+		g.Players[i].Active = true
+		g.Players[i].X, g.Players[i].Y = s[k].X, s[k].Y
+		g.Cells[g.Players[i].Y][g.Players[i].X] = int8(i)
+		g.Players[i].Direction = s[k].Direction
+		if g.Players[i].Direction == "" {
+			g.Players[i].Direction = startDirection(g, g.Players[i].X, g.Players[i].Y)
+		}
+	}
+}
+
+// startDirection returns the starting direction of a player at the given position. Players start moving away from the closest corner.
+func startDirection(g *Game, x, y int) string {
+	switch {
+	case x > g.Width/2 && y > g.Height/2:
+		return DirectionUp
+	case x <= g.Width/2 && y > g.Height/2:
+		return DirectionRight
+	case x > g.Width/2 && y <= g.Height/2:
+		return DirectionLeft
+	case x <= g.Width/2 && y <= g.Height/2:
+		return DirectionDown
+	default:
+		// Just give some direction
+		return DirectionUp
+	}
+}
+
+// spawnAreas returns into how many areas the board is divided (horizontally and vertically) so that n players can start in different areas.
+// Up to 8 players, the board is divided into 4x2 areas.
+func spawnAreas(n int) (int, int) {
+	x, y := 4, 2
+	for x*y < n {
+		if x >= 2*y {
+			y++
+		} else {
+			x++
+		}
+	}
+	return x, y
+}
+
 // MissingPlayer returns how many players are missing for a full, ready game.
 func (g *Game) MissingPlayer() int {
 	g.l.Lock()
@@ -578,11 +833,63 @@ func (g *Game) MissingPlayer() int {
 	return r
 }
 
+// ReduceMaxPlayer reduces the number of players of the game to the players already added, if at least the minimum number of players is present.
+// It returns whether the game is ready afterwards.
+func (g *Game) ReduceMaxPlayer() bool {
+	g.l.Lock()
+	defer g.l.Unlock()
+
+	g.setMaxPlayer()
+
+	min := g.minPlayer
+	if min == 0 {
+		min = 2
+	}
+	if g.numberPlayer < min {
+		return false
+	}
+	g.MaxPlayer = g.numberPlayer
+	return true
+}
+
 // setMaxPlayer sets the maximum number of players if it is zero.
 // Caller has to lock the game.
 func (g *Game) setMaxPlayer() {
+	g.initRandom()
 	if g.MaxPlayer == 0 {
-		g.MaxPlayer = rand.Intn(PlayersPerGame-1) + 2
+		min, max := g.minPlayer, g.maxPlayer
+		if min == 0 {
+			min = 2
+		}
+		if max == 0 {
+			max = PlayersPerGame
+		}
+		g.MaxPlayer = g.rng.Intn(max-min+1) + min
+	}
+}
+
+// initRandom initialises the random number generator of the game from the seed if it is not initialised yet.
+// Caller has to lock the game.
+func (g *Game) initRandom() {
+	if g.rng != nil {
+		return
+	}
+	if g.Seed == 0 {
+		g.Seed = rand.Int63()
+	}
+	g.rng = rand.New(rand.NewSource(g.Seed))
+}
+
+// ClosePlayers closes all players of a game which will not be run, e.g. because it was aborted while waiting for players.
+func (g *Game) ClosePlayers() {
+	g.l.Lock()
+	defer g.l.Unlock()
+
+	for i := range g.Players {
+		err := g.Players[i].Close()
+		if err != nil {
+			log.Println("closing player in game:", err)
+		}
 	}
 }
 
@@ -600,16 +907,21 @@ func (g *Game) ContainsAPI(api string) bool {
 }
 
 // PublicCopy returns a copy of the game with all private fields set to zero.
-// As an exception for AIs, Player.stepCounter is also copied.
+// As an exception for AIs and the rules engine, Player.stepCounter and the round are also copied.
 func (g *Game) PublicCopy() *Game {
 	newG := Game{
-		Width:    g.Width,
-		Height:   g.Height,
-		Cells:    make([][]int8, len(g.Cells)),
-		Players:  make(map[int]*Player, len(g.Players)),
-		You:      g.You,
-		Running:  g.Running,
-		Deadline: g.Deadline,
+		Width:       g.Width,
+		Height:      g.Height,
+		Cells:       make([][]int8, len(g.Cells)),
+		Players:     make(map[int]*Player, len(g.Players)),
+		You:         g.You,
+		Running:     g.Running,
+		Deadline:    g.Deadline,
+		Ranking:     g.Ranking,
+		Rules:       g.Rules,
+		TeamRanking: g.TeamRanking,
+		NewCells:    g.NewCells,
+		round:       g.round,
 	}
 
 	for i := range g.Cells {
@@ -625,6 +937,8 @@ func (g *Game) PublicCopy() *Game {
 			Speed:       g.Players[k].Speed,
 			Active:      g.Players[k].Active,
 			Name:        g.Players[k].Name,
+			Team:        g.Players[k].Team,
+			Elimination: g.Players[k].Elimination,
 			stepCounter: g.Players[k].stepCounter,
 		}
 	}
@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// aiNames returns n names of AIs, repeating the known AIs if needed.
+func aiNames(n int) []string {
+	known := GetAINames()
+	names := make([]string, n)
+	for i := range names {
+		names[i] = known[i%len(known)]
+	}
+	return names
+}
+
+func TestNewPracticeGame(t *testing.T) {
+	tests := []struct {
+		name string
+		ais  []string
+		err  string // empty if the game is valid
+	}{
+		{"single ai", aiNames(1), ""},
+		{"full game", aiNames(PlayersPerGame - 1), ""},
+		{"no ai", nil, "number of ais"},
+		{"too many ais", aiNames(PlayersPerGame), "number of ais"},
+		{"maximum players", aiNames(MaxPlayersPerGame - 1), "number of ais"},
+		{"unknown ai", []string{"NoSuchAI"}, "NoSuchAI"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := NewPracticeGame(tt.ais)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !g.Practice || g.numberPlayer != len(tt.ais) || g.IsReady() {
+					t.Errorf("got %d players, want %d and one free place", g.numberPlayer, len(tt.ais))
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestPracticeEndpointLimit(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/spe_ed?key=x&practice="+strings.Join(aiNames(PlayersPerGame), ","), nil)
+	rw := httptest.NewRecorder()
+	endpoint(rw, r)
+	if rw.Code != http.StatusBadRequest || !strings.Contains(rw.Body.String(), "number of ais") {
+		t.Errorf("got status %d (%s), want %d", rw.Code, rw.Body.String(), http.StatusBadRequest)
+	}
+}
+
+func TestNewTrainingGame(t *testing.T) {
+	tests := []struct {
+		name string
+		ais  []string
+		err  string // empty if the game is valid
+	}{
+		{"single ai", aiNames(1), ""},
+		{"full game", aiNames(PlayersPerGame - 1), ""},
+		{"no ai", nil, "number of ais"},
+		{"too many ais", aiNames(PlayersPerGame), "number of ais"},
+		{"maximum players", aiNames(MaxPlayersPerGame - 1), "number of ais"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := NewTrainingGame(tt.ais)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !g.Practice || !g.Rules.Training || g.numberPlayer != len(tt.ais) {
+					t.Errorf("got training %t with %d players, want %d", g.Rules.Training, g.numberPlayer, len(tt.ais))
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestTrainingEndpointLimit(t *testing.T) {
+	defer func(n int) { NumberTrainingGames = n }(NumberTrainingGames)
+	NumberTrainingGames = 2
+	useKeys(t, "a")
+
+	tests := []struct {
+		name   string
+		ais    int
+		status int
+	}{
+		{"too many ais", PlayersPerGame, http.StatusBadRequest},
+		{"too many games", 1, http.StatusTooManyRequests},
+	}
+	for i := 0; i < NumberTrainingGames; i++ {
+		if status, _ := ClaimTrainingKey("a"); status != KeyOK {
+			t.Fatal("can not claim training key")
+		}
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/spe_ed?key=a&training="+strings.Join(aiNames(tt.ais), ","), nil)
+			rw := httptest.NewRecorder()
+			endpoint(rw, r)
+			if rw.Code != tt.status {
+				t.Errorf("got status %d (%s), want %d", rw.Code, rw.Body.String(), tt.status)
+			}
+		})
+	}
+}
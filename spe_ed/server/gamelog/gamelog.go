@@ -0,0 +1,384 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gamelog reads the game logs written by the spe_ed server.
+// A log is a lz4-compressed file. The first line holds the header of the game, each following line holds one game state.
+// In logs of version 1, the header only contains the players and each state contains the seed. Starting with version 2,
+// each state contains the record of the round leading to it.
+package gamelog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pierrec/lz4/v4"
+)
+
+// Extension is the file extension of all logs.
+const Extension = ".json.lz4"
+
+// Version is the newest version of the log format which can be read.
+const Version = 2
+
+// Header is the beginning of a log. For logs of version 1, only Version and Players are read from the log, the other fields are filled by the Reader and Open if possible.
+type Header struct {
+	Version       int             `json:"version"`
+	ID            string          `json:"id"`
+	Start         time.Time       `json:"start"`
+	ServerVersion string          `json:"serverVersion,omitempty"`
+	Seed          int64           `json:"seed"`
+	Practice      bool            `json:"practice,omitempty"`
+	Rules         json.RawMessage `json:"rules,omitempty"`
+	Players       map[int]Player  `json:"players"`
+}
+
+// Player is the metadata of a player as written at the beginning of a log.
+type Player struct {
+	APIKey    string // fingerprint of the key, empty for AIs and in logs of version 1 (which contain plain keys)
+	Pseudonym string
+	AI        string // name of the AI, empty for human players
+}
+
+// PlayerState is a player as part of a logged state.
+type PlayerState struct {
+	X           int          `json:"x"`
+	Y           int          `json:"y"`
+	Direction   string       `json:"direction"`
+	Speed       int          `json:"speed"`
+	Active      bool         `json:"active"`
+	Name        string       `json:"name,omitempty"`
+	Team        int          `json:"team,omitempty"`
+	Elimination *Elimination `json:"elimination,omitempty"`
+}
+
+// Elimination describes why and when a player was eliminated. It is missing in old logs.
+type Elimination struct {
+	Reason   string `json:"reason"`
+	Round    int    `json:"round"`
+	Opponent int    `json:"opponent,omitempty"`
+}
+
+// Placement is the place of a player (or team) in the final ranking.
+type Placement struct {
+	Player int `json:"player"`
+	Place  int `json:"place"`
+}
+
+// RoundRecord records what happened in a single round. It is missing in logs of version 1.
+type RoundRecord struct {
+	Round        int                 `json:"round"`
+	Deadline     string              `json:"deadline,omitempty"` // deadline sent to the players, without grace time
+	Actions      map[int]Action      `json:"actions"`            // first answer of each player, players without answer are missing
+	Eliminations map[int]Elimination `json:"eliminations,omitempty"`
+}
+
+// Action is an answer of a player.
+type Action struct {
+	Action  string `json:"action"`  // as received, might be invalid
+	Latency int64  `json:"latency"` // time between sending the state and receiving the answer in milliseconds
+}
+
+// State is a single logged game state.
+type State struct {
+	Width       int                  `json:"width"`
+	Height      int                  `json:"height"`
+	Cells       [][]int8             `json:"cells"`
+	Players     map[int]*PlayerState `json:"players"`
+	Running     bool                 `json:"running"`
+	Deadline    string               `json:"deadline,omitempty"`
+	Ranking     []Placement          `json:"ranking,omitempty"`
+	TeamRanking []Placement          `json:"teamRanking,omitempty"`
+	Rules       json.RawMessage      `json:"rules,omitempty"`    // missing in old logs
+	Record      *RoundRecord         `json:"record,omitempty"`   // nil for the initial state
+	Seed        int64                `json:"seed"`               // taken from the header starting with version 2
+	Practice    bool                 `json:"practice,omitempty"` // taken from the header starting with version 2
+
+	Raw json.RawMessage `json:"-"` // the state exactly as found in the log
+}
+
+// Reader reads a single log.
+type Reader struct {
+	Header Header
+
+	r     *bufio.Reader
+	first bool
+}
+
+// NewReader returns a reader for a lz4-compressed log. The header is read immediately.
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{r: bufio.NewReader(lz4.NewReader(r)), first: true}
+	line, err := reader.line()
+	if err == io.EOF {
+		return nil, errors.New("empty log")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(line, &fields)
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	if _, ok := fields["version"]; !ok {
+		// Version 1 - only players
+		reader.Header.Version = 1
+		err = json.Unmarshal(line, &reader.Header.Players)
+		if err != nil {
+			return nil, fmt.Errorf("reading players: %w", err)
+		}
+		// Old servers logged plain keys, which must never be passed on
+		for k, p := range reader.Header.Players {
+			p.APIKey = ""
+			reader.Header.Players[k] = p
+		}
+		return reader, nil
+	}
+	err = json.Unmarshal(line, &reader.Header)
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	if reader.Header.Version < 2 || reader.Header.Version > Version {
+		return nil, fmt.Errorf("unsupported log version %d", reader.Header.Version)
+	}
+	return reader, nil
+}
+
+// Next returns the next state of the log. At the end of the log, io.EOF is returned.
+func (r *Reader) Next() (*State, error) {
+	line, err := r.line()
+	if err != nil {
+		return nil, err
+	}
+	s := new(State)
+	err = json.Unmarshal(line, s)
+	if err != nil {
+		return nil, fmt.Errorf("reading state: %w", err)
+	}
+	s.Raw = line
+	if r.Header.Version == 1 {
+		if r.first {
+			r.Header.Seed, r.Header.Practice, r.Header.Rules = s.Seed, s.Practice, s.Rules
+		}
+	} else {
+		s.Seed, s.Practice = r.Header.Seed, r.Header.Practice
+	}
+	r.first = false
+	return s, nil
+}
+
+// line returns the next non-empty line without the line break.
+func (r *Reader) line() ([]byte, error) {
+	for {
+		line, err := r.r.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+		if len(line) != 0 {
+			if err == io.EOF {
+				// Last line without line break
+				err = nil
+			}
+			return line, err
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// File is a log opened by Open.
+type File struct {
+	*Reader
+	Path string
+	End  time.Time // last modification of the log, usually the end of the game
+
+	f *os.File
+}
+
+// Open opens a log file. The file must be closed after usage.
+func Open(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r, err := NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if r.Header.ID == "" {
+		r.Header.Start, r.Header.ID = ParseName(path)
+	}
+	return &File{Reader: r, Path: path, End: info.ModTime(), f: f}, nil
+}
+
+// Close closes the underlying file.
+func (f *File) Close() error {
+	return f.f.Close()
+}
+
+// ParseName returns the start time and the game id encoded in the name of a log.
+// If the name is not in the format used by the server, a zero time and the name without extension are returned.
+func ParseName(path string) (time.Time, string) {
+	name := strings.TrimSuffix(filepath.Base(path), Extension)
+	i := strings.LastIndex(name, "-")
+	if i == -1 {
+		return time.Time{}, name
+	}
+	start, err := time.Parse(time.RFC3339, name[:i])
+	if err != nil {
+		return time.Time{}, name
+	}
+	return start, name[i+1:]
+}
+
+// List returns the paths of all logs in a directory sorted by name, which is also the order in which the games started.
+func List(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+Extension))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Summary contains the most important information of a game.
+type Summary struct {
+	Header
+	Duration time.Duration
+	Width    int
+	Height   int
+	Rounds   int         // number of rounds in which the players had to send an action
+	Finished bool        // whether the log contains the final state
+	Ranking  []Placement // final ranking, nil if the game is not finished or the log contains no ranking
+	Teams    map[int]int // team of each player, nil if the game was not played in teams
+	Winner   int         // winning player (or team if Teams is set), 0 if the game is not finished, -1 for a draw
+}
+
+// Summarise reads a whole log and summarises it.
+// If the log can not be read completely (e.g. because the server stopped during the game), the summary of all states read so far is returned together with the error.
+func Summarise(path string) (Summary, error) {
+	f, err := Open(path)
+	if err != nil {
+		return Summary{}, err
+	}
+	defer f.Close()
+
+	s := Summary{}
+	if !f.Header.Start.IsZero() {
+		s.Duration = f.End.Sub(f.Header.Start)
+	}
+	for {
+		state, err := f.Next()
+		// Set after each state, since the header of logs of version 1 is completed by the first state
+		s.Header = f.Header
+		if err == io.EOF {
+			return s, nil
+		}
+		if err != nil {
+			return s, fmt.Errorf("%s: %w", path, err)
+		}
+		s.Width, s.Height = state.Width, state.Height
+		if state.Running {
+			s.Rounds++
+			continue
+		}
+		s.Finished = true
+		s.Ranking = state.Ranking
+		ranking := state.Ranking
+		if state.TeamRanking != nil {
+			ranking = state.TeamRanking
+			s.Teams = make(map[int]int, len(state.Players))
+			for k, p := range state.Players {
+				s.Teams[k] = p.Team
+			}
+		}
+		if ranking == nil {
+			// Old logs contain no ranking
+			s.Winner = lastActive(state)
+		} else {
+			s.Winner = winner(ranking)
+		}
+	}
+}
+
+// lastActive returns the only active player of a state or -1 if there is none.
+func lastActive(s *State) int {
+	w := -1
+	for k, p := range s.Players {
+		if !p.Active {
+			continue
+		}
+		if w != -1 {
+			return -1
+		}
+		w = k
+	}
+	return w
+}
+
+// winner returns the only player on the first place of a ranking or -1 if there is none.
+func winner(ranking []Placement) int {
+	w := -1
+	for _, p := range ranking {
+		if p.Place != 1 {
+			continue
+		}
+		if w != -1 {
+			return -1
+		}
+		w = p.Player
+	}
+	return w
+}
+
+// ReadRound returns the state of the given round of a log, starting with 1.
+// The final state of a finished game has the number Summary.Rounds+1.
+func ReadRound(path string, round int) (*State, error) {
+	if round < 1 {
+		return nil, errors.New("round must be at least 1")
+	}
+	f, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	for i := 1; ; i++ {
+		s, err := f.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s: log has only %d states", path, i-1)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if i == round {
+			return s, nil
+		}
+	}
+}
@@ -0,0 +1,267 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gamelog
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pierrec/lz4/v4"
+)
+
+// Logs in the formats written by the server. State lines are shortened to the fields needed by the tests.
+const (
+	v1Header = `{"1":{"APIKey":"plainkey","Pseudonym":"Some-Team-Name","AI":""},"2":{"APIKey":"","Pseudonym":"AI-Name","AI":"SnailAI"}}`
+	v1First  = `{"width":3,"height":1,"cells":[[1,0,2]],"players":{"1":{"x":0,"y":0,"direction":"right","speed":1,"active":true},"2":{"x":2,"y":0,"direction":"left","speed":1,"active":true}},"running":true,"seed":42,"practice":true}`
+	v1Last   = `{"width":3,"height":1,"cells":[[1,-1,2]],"players":{"1":{"x":1,"y":0,"direction":"right","speed":1,"active":true},"2":{"x":1,"y":0,"direction":"left","speed":1,"active":false}},"running":false,"seed":42,"practice":true}`
+
+	v2Header = `{"version":2,"id":"GAMEID","start":"2021-01-02T03:04:05Z","serverVersion":"test","seed":42,"rules":{"torus":false},"players":{"1":{"APIKey":"key-0123456789ab","Pseudonym":"Some-Team-Name","AI":""},"2":{"APIKey":"","Pseudonym":"AI-Name","AI":"SnailAI"}}}`
+	v2First  = `{"width":3,"height":1,"cells":[[1,0,2]],"players":{"1":{"x":0,"y":0,"direction":"right","speed":1,"active":true},"2":{"x":2,"y":0,"direction":"left","speed":1,"active":true}},"running":true,"rules":{"torus":false}}`
+	v2Last   = `{"width":3,"height":1,"cells":[[1,-1,2]],"players":{"1":{"x":1,"y":0,"direction":"right","speed":1,"active":false,"elimination":{"reason":"crash","round":1,"opponent":2}},"2":{"x":1,"y":0,"direction":"left","speed":1,"active":false,"elimination":{"reason":"crash","round":1,"opponent":1}}},"running":false,"ranking":[{"player":1,"place":1},{"player":2,"place":1}],"rules":{"torus":false},"record":{"round":1,"deadline":"2021-01-02T03:04:10Z","actions":{"1":{"action":"change_nothing","latency":12},"2":{"action":"change_nothing","latency":3}},"eliminations":{"1":{"reason":"crash","round":1,"opponent":2},"2":{"reason":"crash","round":1,"opponent":1}}}}`
+)
+
+// compress returns the lines as lz4-compressed log.
+func compress(t *testing.T, lines ...string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w := lz4.NewWriter(&b)
+	for _, l := range lines {
+		_, err := w.Write([]byte(l + "\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// writeLog writes a compressed log to a temporary directory and returns its path.
+func writeLog(t *testing.T, name string, lines ...string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "gamelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, name)
+	err = ioutil.WriteFile(path, compress(t, lines...), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReader(t *testing.T) {
+	tests := []struct {
+		name     string
+		lines    []string
+		version  int
+		id       string
+		practice bool
+		apiKey   string   // plain keys of old logs must be removed
+		records  []bool   // whether each state contains a record
+		raw      []string // expected raw states
+	}{
+		{
+			name:     "version 1",
+			lines:    []string{v1Header, v1First, v1Last},
+			version:  1,
+			practice: true,
+			apiKey:   "",
+			records:  []bool{false, false},
+			raw:      []string{v1First, v1Last},
+		},
+		{
+			name:    "version 2",
+			lines:   []string{v2Header, v2First, "", v2Last},
+			version: 2,
+			id:      "GAMEID",
+			apiKey:  "key-0123456789ab",
+			records: []bool{false, true},
+			raw:     []string{v2First, v2Last},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReader(bytes.NewReader(compress(t, tt.lines...)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Header.Version != tt.version || r.Header.ID != tt.id {
+				t.Errorf("got version %d and id %q, want %d and %q", r.Header.Version, r.Header.ID, tt.version, tt.id)
+			}
+			if r.Header.Players[1].APIKey != tt.apiKey || r.Header.Players[1].Pseudonym != "Some-Team-Name" || r.Header.Players[2].AI != "SnailAI" {
+				t.Errorf("got players %+v", r.Header.Players)
+			}
+
+			states := make([]*State, 0)
+			for {
+				s, err := r.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				states = append(states, s)
+			}
+			if len(states) != len(tt.records) {
+				t.Fatalf("got %d states, want %d", len(states), len(tt.records))
+			}
+
+			if r.Header.Seed != 42 || r.Header.Practice != tt.practice {
+				t.Errorf("got header seed %d and practice %v, want 42 and %v", r.Header.Seed, r.Header.Practice, tt.practice)
+			}
+			for i, s := range states {
+				if s.Seed != 42 || s.Practice != tt.practice {
+					t.Errorf("state %d: got seed %d and practice %v, want 42 and %v", i, s.Seed, s.Practice, tt.practice)
+				}
+				if (s.Record != nil) != tt.records[i] {
+					t.Errorf("state %d: got record %+v", i, s.Record)
+				}
+				if string(s.Raw) != tt.raw[i] {
+					t.Errorf("state %d: raw state differs from log: %s", i, s.Raw)
+				}
+			}
+		})
+	}
+}
+
+func TestReaderRecord(t *testing.T) {
+	want := &RoundRecord{
+		Round:    1,
+		Deadline: "2021-01-02T03:04:10Z",
+		Actions:  map[int]Action{1: {Action: "change_nothing", Latency: 12}, 2: {Action: "change_nothing", Latency: 3}},
+		Eliminations: map[int]Elimination{
+			1: {Reason: "crash", Round: 1, Opponent: 2},
+			2: {Reason: "crash", Round: 1, Opponent: 1},
+		},
+	}
+	r, err := NewReader(bytes.NewReader(compress(t, v2Header, v2Last)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s.Record, want) {
+		t.Errorf("got record %+v, want %+v", s.Record, want)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		err   string
+	}{
+		{"empty", nil, "empty log"},
+		{"unknown version", []string{`{"version":3,"players":{}}`}, "unsupported log version 3"},
+		{"invalid header", []string{`[1,2]`}, "reading header"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewReader(bytes.NewReader(compress(t, tt.lines...)))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSummarise(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		lines    []string
+		id       string
+		rounds   int
+		finished bool
+		winner   int
+	}{
+		{
+			name:     "version 1 without ranking",
+			file:     "2020-12-01T10:00:00+01:00-OLDGAME" + Extension,
+			lines:    []string{v1Header, v1First, v1Last},
+			id:       "OLDGAME",
+			rounds:   1,
+			finished: true,
+			winner:   1,
+		},
+		{
+			name:     "version 2 draw",
+			file:     "2021-01-02T03:04:05Z-OTHERNAME" + Extension,
+			lines:    []string{v2Header, v2First, v2Last},
+			id:       "GAMEID",
+			rounds:   1,
+			finished: true,
+			winner:   -1,
+		},
+		{
+			name:   "unfinished",
+			file:   "2021-01-02T03:04:05Z-GAMEID" + Extension,
+			lines:  []string{v2Header, v2First},
+			id:     "GAMEID",
+			rounds: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Summarise(writeLog(t, tt.file, tt.lines...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.ID != tt.id || s.Rounds != tt.rounds || s.Finished != tt.finished || s.Winner != tt.winner {
+				t.Errorf("got id %q, rounds %d, finished %v, winner %d, want %q, %d, %v, %d", s.ID, s.Rounds, s.Finished, s.Winner, tt.id, tt.rounds, tt.finished, tt.winner)
+			}
+			if s.Width != 3 || s.Height != 1 || s.Seed != 42 {
+				t.Errorf("got board %dx%d and seed %d", s.Width, s.Height, s.Seed)
+			}
+			if s.Start.IsZero() {
+				t.Error("start time is missing")
+			}
+		})
+	}
+}
+
+func TestParseName(t *testing.T) {
+	tests := []struct {
+		path  string
+		start time.Time
+		id    string
+	}{
+		{"log/2021-01-02T03:04:05Z-ABC" + Extension, time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC), "ABC"},
+		{"other" + Extension, time.Time{}, "other"},
+		{"not-a-date" + Extension, time.Time{}, "not-a-date"},
+	}
+	for _, tt := range tests {
+		start, id := ParseName(tt.path)
+		if !start.Equal(tt.start) || id != tt.id {
+			t.Errorf("ParseName(%q) = %v, %q, want %v, %q", tt.path, start, id, tt.start, tt.id)
+		}
+	}
+}
@@ -17,9 +17,22 @@ package main
 
 import (
 	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 )
 
 const (
@@ -32,19 +45,203 @@ const (
 )
 
 // NumberAllowedGames contains the number of games a key can participate in.
-const NumberAllowedGames = 1
+// Must not be changed after InitKeys was called.
+var NumberAllowedGames = 1
 
+// MaxTrainingGames is the maximum value of NumberTrainingGames, so a single key can not occupy the whole server with training games.
+const MaxTrainingGames = 128
+
+// NumberTrainingGames contains the number of training games a key can participate in at the same time.
+// Training games are counted independently of NumberAllowedGames. Must be between 0 and MaxTrainingGames.
+var NumberTrainingGames = 16
+
+// ErrKeyNotFound is returned if a key does not exist.
+var ErrKeyNotFound = errors.New("key not found")
+
+// KeyReloadInterval is the interval at which the key file is checked for changes.
+const KeyReloadInterval = 10 * time.Second
+
+// KeyHashPrefix marks an entry of the key file as salted hash (see HashKey) instead of a plain key.
+const KeyHashPrefix = "sha256:"
+
+// FingerprintSecretSize is the size of a generated fingerprint secret in bytes. Shorter secrets are rejected if they are less than half of it.
+const FingerprintSecretSize = 32
+
+// fingerprintSecret is the server-side secret of all key fingerprints (see KeyFingerprint).
+var fingerprintSecret []byte
+
+// keymap holds the number of available games for each entry of the key file.
+// For plain keys the entry is the key itself, for hashed keys it is the complete line of the key file.
 var keymapLock sync.Mutex
 var keymap = make(map[string]int)
 
+// hashedKeys holds all entries of the key file which are salted hashes.
+var hashedKeys []hashedKey
+
+// resolvedKeys caches the entry belonging to a key, so hashes only have to be computed once per key.
+var resolvedKeys = make(map[string]string)
+
+// keyFileName is the key file given to InitKeys.
+var keyFileName string
+
+// keyFileLock serialises all changes of the key file (see AddKey, RevokeKey).
+var keyFileLock sync.Mutex
+
+// connections holds all connected players for each entry of the key file.
+var connections = make(map[string]map[*Player]bool)
+
+// KeyState is the claim state of a key as reported by ListKeys.
+type KeyState struct {
+	Key         string `json:"key"`         // entry of the key file, i.e. the salted hash for hashed keys
+	Available   int    `json:"available"`   // number of games the key can still join
+	InUse       int    `json:"inUse"`       // number of claims currently held
+	Connections int    `json:"connections"` // number of live websocket connections
+}
+
+type hashedKey struct {
+	entry string
+	salt  []byte
+	hash  []byte
+}
+
+// keyClaims holds the tokens of all claims currently held for each entry of the key file (see ClaimKey).
+var keyClaims = make(map[string]map[uint64]bool)
+
+// lastClaim is the token of the last claim. Tokens are never reused, 0 is never a valid token.
+var lastClaim uint64
+
+// trainingClaims holds the tokens of all training games each key (given by its fingerprint) currently participates in.
+var trainingClaims = make(map[string]map[uint64]bool)
+
+// revokedKeys holds the number of available games of keys which were removed while being in use, so the counter can be restored if they are added again.
+var revokedKeys = make(map[string]int)
+
 // InitKeys initialises all API keys from a file.
+// Each line contains either a plain key or a salted hash as returned by HashKey.
+// The file is reloaded on SIGHUP or if it changes.
 // Not safe to be used in parallel with other key functions.
 func InitKeys(filename string) {
-	f, err := os.Open(filename)
+	keys, hashed, err := readKeys(filename)
+	if err != nil {
+		panic(err)
+	}
+	for k := range keys {
+		keymap[k] = NumberAllowedGames
+	}
+	hashedKeys = hashed
+	keyFileName = filename
+	go keyReloadWorker(filename)
+}
+
+// HashKey returns a key file entry containing a salted hash of the key.
+func HashKey(key string) (string, error) {
+	salt := make([]byte, 16)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(append(salt, key...))
+	return fmt.Sprintf("%s%s:%s", KeyHashPrefix, hex.EncodeToString(salt), hex.EncodeToString(h[:])), nil
+}
+
+// InitFingerprints reads the secret of all key fingerprints (hex encoded) from a file. If the file does not exist, a new random secret is written to it.
+// The secret must be kept private, with it guessed keys can be tested against published fingerprints. Changing it changes all fingerprints.
+// Not safe to be used in parallel with other key functions.
+func InitFingerprints(filename string) {
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		secret := make([]byte, FingerprintSecretSize)
+		_, err = rand.Read(secret)
+		if err != nil {
+			panic(err)
+		}
+		b = []byte(hex.EncodeToString(secret) + "\n")
+		err = ioutil.WriteFile(filename, b, 0600)
+	}
 	if err != nil {
 		panic(err)
 	}
+
+	secret, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		panic(fmt.Errorf("fingerprint secret %s: %w", filename, err))
+	}
+	if len(secret) < FingerprintSecretSize/2 {
+		panic(fmt.Sprintf("fingerprint secret %s: must be at least %d bytes", filename, FingerprintSecretSize/2))
+	}
+	fingerprintSecret = secret
+}
+
+// KeyFingerprint returns a stable identifier of a key which can be logged or published safely.
+// It is a HMAC of the key with the secret given to InitFingerprints, so neither the key can be recovered nor guessed keys can be tested without the secret.
+func KeyFingerprint(key string) string {
+	if fingerprintSecret == nil {
+		panic("fingerprint secret not initialised")
+	}
+	m := hmac.New(sha256.New, fingerprintSecret)
+	m.Write([]byte(key))
+	return "key-" + hex.EncodeToString(m.Sum(nil)[:6])
+}
+
+// IsKeyFingerprint returns whether s has the format of a fingerprint (see KeyFingerprint).
+func IsKeyFingerprint(s string) bool {
+	if !strings.HasPrefix(s, "key-") {
+		return false
+	}
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "key-"))
+	return err == nil && len(b) == 6
+}
+
+// ReloadKeys reloads all API keys from a file. New keys are added, keys missing in the file are revoked.
+// The usage of keys which are in both the old and the new keys is kept.
+// If the file can not be read, the keys are not changed.
+func ReloadKeys(filename string) error {
+	keys, hashed, err := readKeys(filename)
+	if err != nil {
+		return err
+	}
+
+	keymapLock.Lock()
+	defer keymapLock.Unlock()
+
+	added, revoked := 0, 0
+	for k := range keys {
+		if _, ok := keymap[k]; ok {
+			continue
+		}
+		if available, ok := revokedKeys[k]; ok {
+			keymap[k] = available
+			delete(revokedKeys, k)
+		} else {
+			keymap[k] = NumberAllowedGames
+		}
+		added++
+	}
+	for k, available := range keymap {
+		if keys[k] {
+			continue
+		}
+		if available != NumberAllowedGames {
+			revokedKeys[k] = available
+		}
+		delete(keymap, k)
+		revoked++
+	}
+	hashedKeys = hashed
+	log.Println("keys:", "reloaded", filename, "-", added, "added,", revoked, "revoked")
+	return nil
+}
+
+// readKeys reads all entries from a key file. Empty lines and lines starting with # are ignored.
+// Entries starting with KeyHashPrefix are additionally returned as parsed hashes.
+func readKeys(filename string) (map[string]bool, []hashedKey, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
 	defer f.Close()
+	keys := make(map[string]bool)
+	hashed := make([]hashedKey, 0)
 	s := bufio.NewScanner(f)
 	for s.Scan() {
 		text := s.Text()
@@ -54,43 +251,142 @@ func InitKeys(filename string) {
 		if strings.HasPrefix(text, "#") {
 			continue
 		}
-		keymap[text] = NumberAllowedGames
+		if strings.HasPrefix(text, KeyHashPrefix) {
+			parts := strings.Split(strings.TrimPrefix(text, KeyHashPrefix), ":")
+			if len(parts) != 2 {
+				return nil, nil, fmt.Errorf("malformed key hash %s", text)
+			}
+			h := hashedKey{entry: text}
+			h.salt, err = hex.DecodeString(parts[0])
+			if err != nil {
+				return nil, nil, fmt.Errorf("malformed key hash %s: %w", text, err)
+			}
+			h.hash, err = hex.DecodeString(parts[1])
+			if err != nil || len(h.hash) != sha256.Size {
+				return nil, nil, fmt.Errorf("malformed key hash %s", text)
+			}
+			hashed = append(hashed, h)
+		}
+		keys[text] = true
 	}
-	err = s.Err()
-	if err != nil {
-		panic(err)
+	return keys, hashed, s.Err()
+}
+
+// lookupKey returns the key file entry of a key.
+// Caller has to lock keymapLock.
+func lookupKey(key string) (string, bool) {
+	if entry, ok := resolvedKeys[key]; ok {
+		_, valid := keymap[entry]
+		_, revoked := revokedKeys[entry]
+		if valid || revoked {
+			return entry, true
+		}
+	}
+
+	// Hash entries must never be accepted as keys, otherwise knowing the key file would be enough
+	if _, ok := keymap[key]; ok && !strings.HasPrefix(key, KeyHashPrefix) {
+		resolvedKeys[key] = key
+		return key, true
+	}
+	for _, h := range hashedKeys {
+		sum := sha256.Sum256(append(append([]byte(nil), h.salt...), key...))
+		if subtle.ConstantTimeCompare(sum[:], h.hash) == 1 {
+			resolvedKeys[key] = h.entry
+			return h.entry, true
+		}
 	}
+	return "", false
+}
+
+// keyReloadWorker reloads the key file on SIGHUP or if its modification time or size changes.
+func keyReloadWorker(filename string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var modTime time.Time
+	var size int64
+	if info, err := os.Stat(filename); err == nil {
+		modTime, size = info.ModTime(), info.Size()
+	}
+
+	ticker := time.NewTicker(KeyReloadInterval)
+	for {
+		select {
+		case <-hup:
+			log.Println("keys:", "SIGHUP received")
+		case <-ticker.C:
+			info, err := os.Stat(filename)
+			if err != nil {
+				log.Println("keys:", "checking key file:", err)
+				continue
+			}
+			if info.ModTime().Equal(modTime) && info.Size() == size {
+				continue
+			}
+		}
+
+		if info, err := os.Stat(filename); err == nil {
+			modTime, size = info.ModTime(), info.Size()
+		}
+		err := ReloadKeys(filename)
+		if err != nil {
+			log.Println("keys:", "reloading key file:", err)
+		}
+	}
+}
+
+// IsValidKey returns whether the key is a known API key. It does not claim the key.
+func IsValidKey(key string) bool {
+	keymapLock.Lock()
+	defer keymapLock.Unlock()
+
+	entry, ok := lookupKey(key)
+	if !ok {
+		return false
+	}
+	_, ok = keymap[entry]
+	return ok
 }
 
 // ClaimKey tries to claim an API key.
-// If it returns KeyOK, the number of usage of that key is internally increased, for all other values nothing changes.
-// Keys are loaded from "./keys"
-func ClaimKey(key string) int {
+// If it returns KeyOK, the number of usage of that key is internally increased and the token of the claim is returned, which has to be
+// passed to ReleaseKey. For all other values nothing changes.
+func ClaimKey(key string) (int, uint64) {
 	if key == "" {
-		log.Println("keys:", "invalid", key)
-		return KeyInvalid
+		log.Println("keys:", "invalid", "(empty)")
+		return KeyInvalid, 0
 	}
 
 	keymapLock.Lock()
 	defer keymapLock.Unlock()
 
-	available, ok := keymap[key]
+	entry, ok := lookupKey(key)
+	if !ok {
+		log.Println("keys:", "invalid", KeyFingerprint(key))
+		return KeyInvalid, 0
+	}
+	available, ok := keymap[entry]
 	if !ok {
-		log.Println("keys:", "invalid", key)
-		return KeyInvalid
+		log.Println("keys:", "invalid", KeyFingerprint(key))
+		return KeyInvalid, 0
 	}
 	if available == 0 {
-		log.Println("keys:", "ratelimit", key)
-		return KeyRateLimit
+		log.Println("keys:", "ratelimit", KeyFingerprint(key))
+		return KeyRateLimit, 0
 	}
-	keymap[key] = available - 1
-	log.Println("keys:", "ok", key)
-	return KeyOK
+	keymap[entry] = available - 1
+	if keyClaims[entry] == nil {
+		keyClaims[entry] = make(map[uint64]bool)
+	}
+	lastClaim++
+	keyClaims[entry][lastClaim] = true
+	log.Println("keys:", "ok", KeyFingerprint(key))
+	return KeyOK, lastClaim
 }
 
-// ReleaseKey releases a key thus making it claimable again.
-// Each call releases it for exactly one claim.
-func ReleaseKey(key string) {
+// ReleaseKey releases the claim of a key with the given token thus making the key claimable again.
+// Releasing a claim which is not held (e.g. released twice or released by ForceReleaseKey) has no effect.
+func ReleaseKey(key string, claim uint64) {
 	if key == "" {
 		return
 	}
@@ -98,9 +394,259 @@ func ReleaseKey(key string) {
 	keymapLock.Lock()
 	defer keymapLock.Unlock()
 
-	available, ok := keymap[key]
+	entry, ok := lookupKey(key)
+	if !ok || !keyClaims[entry][claim] {
+		return
+	}
+	delete(keyClaims[entry], claim)
+	if len(keyClaims[entry]) == 0 {
+		delete(keyClaims, entry)
+	}
+
+	available, ok := keymap[entry]
 	if !ok {
+		if available, ok := revokedKeys[entry]; ok {
+			if available+1 >= NumberAllowedGames {
+				delete(revokedKeys, entry)
+			} else {
+				revokedKeys[entry] = available + 1
+			}
+		}
 		return
 	}
-	keymap[key] = available + 1
+	keymap[entry] = available + 1
+}
+
+// ClaimTrainingKey claims a key for a training game. Returns the status of the key and the token of the claim (see ClaimKey).
+// Training games are limited by NumberTrainingGames instead of NumberAllowedGames.
+func ClaimTrainingKey(key string) (int, uint64) {
+	if key == "" {
+		log.Println("keys:", "invalid", "(empty)")
+		return KeyInvalid, 0
+	}
+
+	keymapLock.Lock()
+	defer keymapLock.Unlock()
+
+	entry, ok := lookupKey(key)
+	if !ok {
+		log.Println("keys:", "invalid", KeyFingerprint(key))
+		return KeyInvalid, 0
+	}
+	if _, ok := keymap[entry]; !ok {
+		log.Println("keys:", "invalid", KeyFingerprint(key))
+		return KeyInvalid, 0
+	}
+	fingerprint := KeyFingerprint(key)
+	if len(trainingClaims[fingerprint]) >= NumberTrainingGames {
+		log.Println("keys:", "training ratelimit", fingerprint)
+		return KeyRateLimit, 0
+	}
+	if trainingClaims[fingerprint] == nil {
+		trainingClaims[fingerprint] = make(map[uint64]bool)
+	}
+	lastClaim++
+	trainingClaims[fingerprint][lastClaim] = true
+	return KeyOK, lastClaim
+}
+
+// ReleaseTrainingKey releases the claim of a key with the given token which was returned by ClaimTrainingKey.
+// Releasing a claim which is not held has no effect.
+func ReleaseTrainingKey(key string, claim uint64) {
+	fingerprint := KeyFingerprint(key)
+
+	keymapLock.Lock()
+	defer keymapLock.Unlock()
+
+	delete(trainingClaims[fingerprint], claim)
+	if len(trainingClaims[fingerprint]) == 0 {
+		delete(trainingClaims, fingerprint)
+	}
+}
+
+// ListKeys returns the claim state of all keys ordered by key file entry.
+func ListKeys() []KeyState {
+	keymapLock.Lock()
+	defer keymapLock.Unlock()
+
+	list := make([]KeyState, 0, len(keymap))
+	for k, available := range keymap {
+		list = append(list, KeyState{Key: k, Available: available, InUse: NumberAllowedGames - available, Connections: len(connections[k])})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+// AddKey adds a key to the key file and reloads it. If hashed is true, only a salted hash of the key is stored.
+func AddKey(key string, hashed bool) error {
+	if key == "" || strings.HasPrefix(key, "#") || strings.HasPrefix(key, KeyHashPrefix) || strings.ContainsAny(key, "\r\n") {
+		return fmt.Errorf("invalid key")
+	}
+
+	keyFileLock.Lock()
+	defer keyFileLock.Unlock()
+
+	if IsValidKey(key) {
+		return fmt.Errorf("key already exists")
+	}
+
+	entry := key
+	if hashed {
+		var err error
+		entry, err = HashKey(key)
+		if err != nil {
+			return err
+		}
+	}
+
+	b, err := ioutil.ReadFile(keyFileName)
+	if err != nil {
+		return err
+	}
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		b = append(b, '\n')
+	}
+	b = append(b, entry...)
+	b = append(b, '\n')
+
+	err = writeKeyFile(b)
+	if err != nil {
+		return err
+	}
+	return ReloadKeys(keyFileName)
+}
+
+// RevokeKey removes a key from the key file, reloads it and closes all live connections using the key.
+// The key can either be given as plain key or as key file entry (e.g. as returned by ListKeys).
+func RevokeKey(key string) error {
+	keyFileLock.Lock()
+	defer keyFileLock.Unlock()
+
+	keymapLock.Lock()
+	entry, ok := lookupKey(key)
+	if _, exists := keymap[key]; !ok && exists {
+		entry, ok = key, true
+	}
+	if _, exists := keymap[entry]; !ok || !exists {
+		keymapLock.Unlock()
+		return ErrKeyNotFound
+	}
+	players := make([]*Player, 0, len(connections[entry]))
+	for p := range connections[entry] {
+		players = append(players, p)
+	}
+	keymapLock.Unlock()
+
+	b, err := ioutil.ReadFile(keyFileName)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(b), "\n")
+	kept := make([]string, 0, len(lines))
+	for _, l := range lines {
+		if l != entry {
+			kept = append(kept, l)
+		}
+	}
+	err = writeKeyFile([]byte(strings.Join(kept, "\n")))
+	if err != nil {
+		return err
+	}
+	err = ReloadKeys(keyFileName)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range players {
+		err := p.Close()
+		if err != nil {
+			log.Println("keys:", "closing revoked connection:", err)
+		}
+	}
+	return nil
+}
+
+// writeKeyFile replaces the content of the key file.
+// Caller has to lock keyFileLock.
+func writeKeyFile(b []byte) error {
+	return replaceFile(keyFileName, b)
+}
+
+// replaceFile replaces the content of a file, keeping its permissions. The file is replaced atomically, so it is never read partially written.
+func replaceFile(filename string, b []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(filename); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+"-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// ForceReleaseKey releases all claims of a key, e.g. if it is stuck in KeyRateLimit. It returns false if the key does not exist.
+// The key can either be given as plain key or as key file entry (e.g. as returned by ListKeys).
+// The tokens of all claims are invalidated, so claims still held by running games are ignored when they are released later
+// and the key never exceeds NumberAllowedGames.
+func ForceReleaseKey(key string) bool {
+	keymapLock.Lock()
+	defer keymapLock.Unlock()
+
+	entry, ok := lookupKey(key)
+	if !ok {
+		entry = key
+	}
+	if _, ok := keymap[entry]; !ok {
+		return false
+	}
+	keymap[entry] = NumberAllowedGames
+	delete(keyClaims, entry)
+	return true
+}
+
+// registerConnection marks a player as live connection of its key.
+func registerConnection(p *Player) {
+	keymapLock.Lock()
+	defer keymapLock.Unlock()
+
+	entry, ok := lookupKey(p.api)
+	if !ok {
+		return
+	}
+	if connections[entry] == nil {
+		connections[entry] = make(map[*Player]bool)
+	}
+	connections[entry][p] = true
+}
+
+// unregisterConnection removes a player from the live connections of its key.
+func unregisterConnection(p *Player) {
+	keymapLock.Lock()
+	defer keymapLock.Unlock()
+
+	// The key might be revoked already, so search all entries
+	for entry := range connections {
+		delete(connections[entry], p)
+		if len(connections[entry]) == 0 {
+			delete(connections, entry)
+		}
+	}
 }
@@ -0,0 +1,285 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeKeys replaces the content of a key file.
+func writeKeys(t *testing.T, filename string, lines ...string) {
+	t.Helper()
+	err := ioutil.WriteFile(filename, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// claimStatus claims a key and returns only its status.
+func claimStatus(key string) int {
+	status, _ := ClaimKey(key)
+	return status
+}
+
+func TestReloadKeys(t *testing.T) {
+	useKeys(t, "kept", "removed")
+	filename := tempFile(t, "keys", "")
+
+	status, removedClaim := ClaimKey("removed")
+	if claimStatus("kept") != KeyOK || status != KeyOK {
+		t.Fatal("can not claim keys")
+	}
+
+	writeKeys(t, filename, "# comment", "kept", "", "new")
+	err := ReloadKeys(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		key    string
+		status int
+	}{
+		{"kept", KeyRateLimit},
+		{"new", KeyOK},
+		{"removed", KeyInvalid},
+		{"# comment", KeyInvalid},
+	}
+	for _, tt := range tests {
+		if got := claimStatus(tt.key); got != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.key, got, tt.status)
+		}
+	}
+
+	// Adding a key again restores its usage until the claim is released
+	writeKeys(t, filename, "kept", "new", "removed")
+	err = ReloadKeys(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := claimStatus("removed"); got != KeyRateLimit {
+		t.Errorf("key added again: got status %d, want %d", got, KeyRateLimit)
+	}
+	ReleaseKey("removed", removedClaim)
+	status, removedClaim = ClaimKey("removed")
+	if status != KeyOK {
+		t.Errorf("key added again after release: got status %d, want %d", status, KeyOK)
+	}
+
+	// Releasing a revoked key must not add it again
+	writeKeys(t, filename, "new")
+	err = ReloadKeys(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ReleaseKey("removed", removedClaim)
+	if IsValidKey("removed") || len(revokedKeys) != 1 {
+		t.Errorf("revoked keys: got %v", revokedKeys)
+	}
+}
+
+func TestReloadKeysHashed(t *testing.T) {
+	useKeys(t)
+	entry, err := HashKey("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := tempFile(t, "keys", entry+"\n")
+	err = ReloadKeys(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsValidKey("secret") {
+		t.Error("hashed key not valid")
+	}
+	if IsValidKey(entry) {
+		t.Error("key file entry accepted as key")
+	}
+	if claimStatus("secret") != KeyOK {
+		t.Fatal("can not claim hashed key")
+	}
+	list := ListKeys()
+	if len(list) != 1 || list[0].Key != entry || list[0].InUse != 1 {
+		t.Errorf("got key list %+v", list)
+	}
+
+	// Revoking the hash revokes the key, even if it was resolved before
+	writeKeys(t, filename, "other")
+	err = ReloadKeys(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsValidKey("secret") {
+		t.Error("revoked hashed key still valid")
+	}
+}
+
+func TestReloadKeysError(t *testing.T) {
+	useKeys(t, "a")
+	tests := []struct {
+		name  string
+		lines []string
+	}{
+		{"malformed hash", []string{"b", KeyHashPrefix + "00"}},
+		{"invalid salt", []string{"b", KeyHashPrefix + "xx:" + strings.Repeat("00", 32)}},
+		{"short hash", []string{"b", KeyHashPrefix + "00:00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := tempFile(t, "keys", "")
+			writeKeys(t, filename, tt.lines...)
+			if err := ReloadKeys(filename); err == nil {
+				t.Error("no error for malformed key file")
+			}
+			if !IsValidKey("a") || IsValidKey("b") {
+				t.Error("keys changed by malformed key file")
+			}
+		})
+	}
+
+	if err := ReloadKeys(tempFile(t, "keys", "") + ".missing"); err == nil {
+		t.Error("no error for missing key file")
+	}
+	if !IsValidKey("a") {
+		t.Error("keys changed by missing key file")
+	}
+}
+
+func TestForceReleaseKey(t *testing.T) {
+	defer func(n int) { NumberAllowedGames = n }(NumberAllowedGames)
+	NumberAllowedGames = 2
+	useKeys(t, "a")
+
+	_, first := ClaimKey("a")
+	_, second := ClaimKey("a")
+	if claimStatus("a") != KeyRateLimit {
+		t.Fatal("key not rate limited")
+	}
+	if !ForceReleaseKey("a") || ForceReleaseKey("unknown") {
+		t.Fatal("wrong result of ForceReleaseKey")
+	}
+
+	status, third := ClaimKey("a")
+	if status != KeyOK {
+		t.Fatal("can not claim key after forced release")
+	}
+	// Claims from before the forced release must not free the key for more than NumberAllowedGames games
+	ReleaseKey("a", first)
+	ReleaseKey("a", second)
+	if list := ListKeys(); list[0].InUse != 1 {
+		t.Errorf("got %d claims in use, want 1", list[0].InUse)
+	}
+	if claimStatus("a") != KeyOK || claimStatus("a") != KeyRateLimit {
+		t.Error("key exceeds NumberAllowedGames")
+	}
+
+	ReleaseKey("a", third)
+	ReleaseKey("a", third)
+	if list := ListKeys(); list[0].InUse != 1 {
+		t.Errorf("released twice: got %d claims in use, want 1", list[0].InUse)
+	}
+}
+
+func TestKeyFingerprint(t *testing.T) {
+	f := KeyFingerprint("plainkey")
+	if !IsKeyFingerprint(f) {
+		t.Errorf("fingerprint %s has wrong format", f)
+	}
+	if f != KeyFingerprint("plainkey") || f == KeyFingerprint("otherkey") {
+		t.Error("fingerprints not stable or not distinct")
+	}
+	for _, s := range []string{"plainkey", "key-", "key-0123456789", "key-0123456789abcd", "key-0123456789xy"} {
+		if IsKeyFingerprint(s) {
+			t.Errorf("%q accepted as fingerprint", s)
+		}
+	}
+
+	defer func(secret []byte) { fingerprintSecret = secret }(fingerprintSecret)
+	fingerprintSecret = []byte("another secret")
+	if KeyFingerprint("plainkey") == f {
+		t.Error("fingerprint does not depend on the secret")
+	}
+}
+
+func TestInitFingerprints(t *testing.T) {
+	defer func(secret []byte) { fingerprintSecret = secret }(fingerprintSecret)
+	filename := filepath.Join(filepath.Dir(tempFile(t, "unused", "")), "secret")
+
+	InitFingerprints(filename)
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("secret file has permissions %v", info.Mode().Perm())
+	}
+	f := KeyFingerprint("plainkey")
+	fingerprintSecret = nil
+	InitFingerprints(filename)
+	if KeyFingerprint("plainkey") != f {
+		t.Error("fingerprint changed after reading the secret again")
+	}
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"empty", ""},
+		{"not hex", strings.Repeat("x", 2*FingerprintSecretSize)},
+		{"too short", strings.Repeat("ab", FingerprintSecretSize/2-1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("invalid secret accepted")
+				}
+			}()
+			InitFingerprints(tempFile(t, "secret", tt.content))
+		})
+	}
+}
+
+func TestTrainingClaims(t *testing.T) {
+	defer func(n int) { NumberTrainingGames = n }(NumberTrainingGames)
+	NumberTrainingGames = 2
+	useKeys(t, "a")
+
+	_, first := ClaimTrainingKey("a")
+	status, _ := ClaimTrainingKey("a")
+	if status != KeyOK {
+		t.Fatal("can not claim training key")
+	}
+	if status, _ := ClaimTrainingKey("a"); status != KeyRateLimit {
+		t.Errorf("got status %d, want %d", status, KeyRateLimit)
+	}
+	if _, ok := trainingClaims["a"]; ok || len(trainingClaims[KeyFingerprint("a")]) != 2 {
+		t.Errorf("training claims not stored by fingerprint: %v", trainingClaims)
+	}
+
+	ReleaseTrainingKey("a", first)
+	ReleaseTrainingKey("a", first)
+	if status, _ := ClaimTrainingKey("a"); status != KeyOK {
+		t.Error("can not claim training key after release")
+	}
+	if status, _ := ClaimTrainingKey("a"); status != KeyRateLimit {
+		t.Error("claim released twice")
+	}
+}
@@ -0,0 +1,321 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// GameResult is the stored result of a finished (non-practice) game.
+type GameResult struct {
+	ID      string
+	End     time.Time
+	Players []RatingResult
+	Teams   bool // whether the game was played in teams, all players of a team share the place of their team
+}
+
+// LeaderboardEntry contains the accumulated results of a single key (shown by pseudonym) or AI.
+type LeaderboardEntry struct {
+	Name             string  `json:"name"`
+	AI               bool    `json:"ai"`
+	Games            int     `json:"games"`
+	Wins             int     `json:"wins"`
+	AveragePlacement float64 `json:"averagePlacement"`
+	WinRate          float64 `json:"winRate"`
+}
+
+var (
+	leaderboardEnabled = false
+	// leaderboardWindow is the default time window of the leaderboard. 0 means all results are used.
+	leaderboardWindow = 30 * 24 * time.Hour
+
+	resultsLock sync.Mutex
+	results     []GameResult
+	resultsFile *os.File
+)
+
+var leaderboardTemplate = template.Must(template.New("leaderboard").Funcs(template.FuncMap{"inc": func(i int) int { return i + 1 }}).Parse(`
+<!DOCTYPE HTML>
+<html lang="en">
+<body>
+	<h1>Leaderboard</h1>
+	<p>Time: {{ .Time.UTC.Format "2006-01-02T15:04:05Z07:00" }}</p>
+	<p>Window: {{ if .Window }}{{ .Window }}{{ else }}all results{{ end }}</p>
+	{{ if .Entries }}
+	<table>
+		<tr>
+			<th>#</th>
+			<th>Name</th>
+			<th>Bot</th>
+			<th><a href="?sort=games{{ .Query }}">Games</a></th>
+			<th><a href="?sort=wins{{ .Query }}">Wins</a></th>
+			<th><a href="?sort=placement{{ .Query }}">Avg. placement</a></th>
+			<th><a href="?sort=winrate{{ .Query }}">Win rate</a></th>
+		</tr>
+		{{ range $i, $e := .Entries }}
+		<tr>
+			<td>{{ inc $i }}</td>
+			<td>{{ $e.Name }}</td>
+			<td>{{ $e.AI }}</td>
+			<td>{{ $e.Games }}</td>
+			<td>{{ $e.Wins }}</td>
+			<td>{{ printf "%.2f" $e.AveragePlacement }}</td>
+			<td>{{ printf "%.1f%%" $e.WinRate }}</td>
+		</tr>
+		{{ end }}
+	</table>
+	{{ else }}
+	<p>Empty</p>
+	{{ end }}
+</body>
+</html>
+`))
+
+// InitResults loads all stored game results from a file containing one JSON encoded GameResult per line.
+// New results are appended to the file, which will be created if non-existing.
+// Plain API keys stored by older versions of the server are replaced by their fingerprints (see KeyFingerprint) and the file is rewritten without them.
+// Not safe to be used in parallel with other result functions.
+func InitResults(filename string) {
+	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		panic(err)
+	}
+
+	migrated := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var r GameResult
+		err := json.Unmarshal(scanner.Bytes(), &r)
+		if err != nil {
+			panic(err)
+		}
+		for i := range r.Players {
+			if !r.Players[i].AI && !IsKeyFingerprint(r.Players[i].Name) {
+				r.Players[i].Name = KeyFingerprint(r.Players[i].Name)
+				migrated++
+			}
+		}
+		results = append(results, r)
+	}
+	if err := scanner.Err(); err != nil {
+		panic(err)
+	}
+
+	if migrated != 0 {
+		f.Close()
+		var buf bytes.Buffer
+		for i := range results {
+			b, err := json.Marshal(results[i])
+			if err != nil {
+				panic(err)
+			}
+			buf.Write(b)
+			buf.WriteByte('\n')
+		}
+		err = replaceFile(filename, buf.Bytes())
+		if err != nil {
+			panic(err)
+		}
+		f, err = os.OpenFile(filename, os.O_RDWR, 0644)
+		if err != nil {
+			panic(err)
+		}
+		log.Println("results:", "migrated", migrated, "keys to fingerprints")
+	}
+
+	_, err = f.Seek(0, io.SeekEnd)
+	if err != nil {
+		panic(err)
+	}
+	resultsFile = f
+}
+
+// StoreResult stores the result of a game. Has no effect if the results were not initialised.
+func StoreResult(r GameResult) {
+	resultsLock.Lock()
+	defer resultsLock.Unlock()
+
+	if resultsFile == nil {
+		return
+	}
+
+	results = append(results, r)
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		log.Println("results:", err)
+		return
+	}
+	b = append(b, '\n')
+	_, err = resultsFile.Write(b)
+	if err != nil {
+		log.Println("results:", err)
+	}
+}
+
+// Leaderboard returns the accumulated results of all games which ended after since.
+// The entries are ordered by sortBy ("games", "wins", "placement" or "winrate", the default).
+func Leaderboard(since time.Time, sortBy string) []LeaderboardEntry {
+	type identity struct {
+		name string
+		ai   bool
+	}
+	entries := make(map[identity]*LeaderboardEntry)
+	placements := make(map[identity]int)
+
+	resultsLock.Lock()
+	for i := range results {
+		if results[i].End.Before(since) {
+			continue
+		}
+		winners := 0
+		for _, p := range results[i].Players {
+			if p.Place == 1 {
+				winners++
+			}
+		}
+		for _, p := range results[i].Players {
+			id := identity{p.Name, p.AI}
+			e, ok := entries[id]
+			if !ok {
+				e = &LeaderboardEntry{Name: p.Name, AI: p.AI}
+				if !p.AI {
+					e.Name = GlobalPseudonym.Get(p.Name)
+				}
+				entries[id] = e
+			}
+			e.Games++
+			if p.Place == 1 && (winners == 1 || results[i].Teams) {
+				e.Wins++
+			}
+			placements[id] += p.Place
+		}
+	}
+	resultsLock.Unlock()
+
+	list := make([]LeaderboardEntry, 0, len(entries))
+	for id, e := range entries {
+		e.AveragePlacement = float64(placements[id]) / float64(e.Games)
+		e.WinRate = 100 * float64(e.Wins) / float64(e.Games)
+		list = append(list, *e)
+	}
+
+	var less func(a, b LeaderboardEntry) bool
+	switch sortBy {
+	case "games":
+		less = func(a, b LeaderboardEntry) bool { return a.Games > b.Games }
+	case "wins":
+		less = func(a, b LeaderboardEntry) bool { return a.Wins > b.Wins }
+	case "placement":
+		less = func(a, b LeaderboardEntry) bool { return a.AveragePlacement < b.AveragePlacement }
+	default:
+		less = func(a, b LeaderboardEntry) bool { return a.WinRate > b.WinRate }
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if less(list[i], list[j]) {
+			return true
+		}
+		if less(list[j], list[i]) {
+			return false
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// leaderboardEndpoint serves the leaderboard as HTML. The parameter "window" (parseable by time.Duration, 0 means all results) overrides
+// the default time window, "sort" selects the order (see Leaderboard).
+func leaderboardEndpoint(rw http.ResponseWriter, r *http.Request) {
+	window, entries, ok := leaderboardRequest(rw, r)
+	if !ok {
+		return
+	}
+
+	query := ""
+	if w := r.URL.Query().Get("window"); w != "" {
+		query = "&window=" + template.URLQueryEscaper(w)
+	}
+
+	var buf bytes.Buffer
+	err := leaderboardTemplate.Execute(&buf, struct {
+		Time    time.Time
+		Window  time.Duration
+		Query   template.URL
+		Entries []LeaderboardEntry
+	}{time.Now(), window, template.URL(query), entries})
+	if err != nil {
+		log.Println("leaderboard:", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		rw.Write([]byte(err.Error()))
+		return
+	}
+	rw.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	rw.Write(buf.Bytes())
+}
+
+// leaderboardJSONEndpoint serves the leaderboard as JSON. It accepts the same parameters as leaderboardEndpoint.
+func leaderboardJSONEndpoint(rw http.ResponseWriter, r *http.Request) {
+	_, entries, ok := leaderboardRequest(rw, r)
+	if !ok {
+		return
+	}
+
+	b, err := json.Marshal(entries)
+	if err != nil {
+		log.Println("leaderboard:", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		rw.Write([]byte(err.Error()))
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Access-Control-Allow-Origin", "*")
+	rw.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	rw.Write(b)
+}
+
+// leaderboardRequest parses the parameters of a leaderboard request and returns the time window and the entries.
+// If ok is false, an error was already written to rw.
+func leaderboardRequest(rw http.ResponseWriter, r *http.Request) (window time.Duration, entries []LeaderboardEntry, ok bool) {
+	window = leaderboardWindow
+	if w := r.URL.Query().Get("window"); w != "" {
+		var err error
+		window, err = time.ParseDuration(w)
+		if err != nil || window < 0 {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("invalid window"))
+			return 0, nil, false
+		}
+	}
+
+	since := time.Time{}
+	if window > 0 {
+		since = time.Now().Add(-window)
+	}
+	return window, Leaderboard(since, r.URL.Query().Get("sort")), true
+}
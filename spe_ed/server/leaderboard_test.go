@@ -0,0 +1,207 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useResults stores all results of a test in a new file and restores the previous results afterwards.
+// It returns the path of the file.
+func useResults(t *testing.T) string {
+	t.Helper()
+	resultsLock.Lock()
+	old, oldFile := results, resultsFile
+	results, resultsFile = nil, nil
+	resultsLock.Unlock()
+
+	path := tempFile(t, "results", "")
+	InitResults(path)
+	t.Cleanup(func() {
+		resultsLock.Lock()
+		defer resultsLock.Unlock()
+		resultsFile.Close()
+		results, resultsFile = old, oldFile
+	})
+	return path
+}
+
+// reloadResults reads the results from the file again, as done on startup.
+func reloadResults(t *testing.T, path string) {
+	t.Helper()
+	resultsLock.Lock()
+	resultsFile.Close()
+	results, resultsFile = nil, nil
+	resultsLock.Unlock()
+	InitResults(path)
+}
+
+func TestResultsAfterGame(t *testing.T) {
+	path := useResults(t)
+	runAIGame(t, []string{"StupidAI", "SnailAI"}, false)
+	runAIGame(t, []string{"StupidAI", "SnailAI"}, true)
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d results, want 1 (practice games are not stored)", len(lines))
+	}
+	var r GameResult
+	err = json.Unmarshal([]byte(lines[0]), &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(r.Players))
+	for _, p := range r.Players {
+		if !p.AI {
+			t.Errorf("AI was stored as key: %+v", p)
+		}
+		names = append(names, p.Name)
+	}
+	if strings.Join(names, ",") != "StupidAI,SnailAI" && strings.Join(names, ",") != "SnailAI,StupidAI" {
+		t.Errorf("got players %v", names)
+	}
+
+	reloadResults(t, path)
+	list := Leaderboard(time.Time{}, "")
+	if len(list) != 2 {
+		t.Fatalf("got leaderboard %+v, want two AIs", list)
+	}
+	for _, e := range list {
+		if !e.AI || e.Games != 1 || (e.Name != "StupidAI" && e.Name != "SnailAI") {
+			t.Errorf("got entry %+v", e)
+		}
+	}
+}
+
+func TestResultsMigrateKeys(t *testing.T) {
+	path := useResults(t)
+	old := `{"ID":"a","End":"2021-01-01T00:00:00Z","Players":[{"Name":"plainkey","AI":false,"Place":1},{"Name":"SnailAI","AI":true,"Place":2}],"Teams":false}` + "\n" +
+		`{"ID":"b","End":"2021-01-02T00:00:00Z","Players":[{"Name":"` + KeyFingerprint("other") + `","AI":false,"Place":1}],"Teams":false}` + "\n"
+	err := ioutil.WriteFile(path, []byte(old), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloadResults(t, path)
+
+	want := [][]RatingResult{
+		{{Name: KeyFingerprint("plainkey"), Place: 1}, {Name: "SnailAI", AI: true, Place: 2}},
+		{{Name: KeyFingerprint("other"), Place: 1}},
+	}
+	resultsLock.Lock()
+	got := make([][]RatingResult, len(results))
+	for i := range results {
+		got[i] = results[i].Players
+	}
+	resultsLock.Unlock()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got players %+v, want %+v", got, want)
+	}
+
+	// The file must not contain the key anymore and new results must still be appended
+	StoreResult(GameResult{ID: "c", End: time.Now()})
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "plainkey") {
+		t.Error("result file still contains the plain key")
+	}
+	if lines := strings.Split(strings.TrimSpace(string(b)), "\n"); len(lines) != 3 {
+		t.Errorf("got %d results in file, want 3", len(lines))
+	}
+}
+
+func TestLeaderboard(t *testing.T) {
+	useResults(t)
+	usePseudonyms(t, map[string]string{"key-a": "Team-A", "key-b": "Team-B"})
+	now := time.Now()
+	StoreResult(GameResult{ID: "old", End: now.Add(-48 * time.Hour), Players: []RatingResult{{Name: "key-a", Place: 2}, {Name: "SnailAI", AI: true, Place: 1}}})
+	StoreResult(GameResult{ID: "win", End: now, Players: []RatingResult{{Name: "key-a", Place: 1}, {Name: "key-b", Place: 2}, {Name: "SnailAI", AI: true, Place: 3}}})
+	StoreResult(GameResult{ID: "draw", End: now, Players: []RatingResult{{Name: "key-a", Place: 1}, {Name: "key-b", Place: 1}}})
+	StoreResult(GameResult{ID: "teams", End: now, Teams: true, Players: []RatingResult{{Name: "key-b", Place: 1}, {Name: "key-a", Place: 2}, {Name: "SnailAI", AI: true, Place: 1}}})
+
+	tests := []struct {
+		name   string
+		since  time.Time
+		sortBy string
+		want   []LeaderboardEntry
+	}{
+		{
+			name:  "window",
+			since: now.Add(-time.Hour),
+			want: []LeaderboardEntry{
+				{Name: "SnailAI", AI: true, Games: 2, Wins: 1, AveragePlacement: 2, WinRate: 50},
+				{Name: "Team-A", Games: 3, Wins: 1, AveragePlacement: 4.0 / 3, WinRate: 100.0 / 3},
+				{Name: "Team-B", Games: 3, Wins: 1, AveragePlacement: 4.0 / 3, WinRate: 100.0 / 3},
+			},
+		},
+		{
+			name:   "all results by games",
+			sortBy: "games",
+			want: []LeaderboardEntry{
+				{Name: "Team-A", Games: 4, Wins: 1, AveragePlacement: 6.0 / 4, WinRate: 25},
+				{Name: "SnailAI", AI: true, Games: 3, Wins: 2, AveragePlacement: 5.0 / 3, WinRate: 200.0 / 3},
+				{Name: "Team-B", Games: 3, Wins: 1, AveragePlacement: 4.0 / 3, WinRate: 100.0 / 3},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Leaderboard(tt.since, tt.sortBy)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLeaderboardEndpoint(t *testing.T) {
+	useResults(t)
+	StoreResult(GameResult{ID: "game", End: time.Now(), Players: []RatingResult{{Name: "StupidAI", AI: true, Place: 1}, {Name: "SnailAI", AI: true, Place: 2}}})
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		query   string
+		status  int
+		body    string
+	}{
+		{"json", leaderboardJSONEndpoint, "", http.StatusOK, `"name":"StupidAI","ai":true,"games":1,"wins":1`},
+		{"html", leaderboardEndpoint, "?window=1h", http.StatusOK, "<td>StupidAI</td>"},
+		{"invalid window", leaderboardJSONEndpoint, "?window=soon", http.StatusBadRequest, "invalid window"},
+		{"negative window", leaderboardEndpoint, "?window=-1h", http.StatusBadRequest, "invalid window"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			tt.handler(rw, httptest.NewRequest(http.MethodGet, "/leaderboard"+tt.query, nil))
+			if rw.Code != tt.status || !strings.Contains(rw.Body.String(), tt.body) {
+				t.Errorf("got status %d (%s), want %d (%s)", rw.Code, rw.Body.String(), tt.status, tt.body)
+			}
+		})
+	}
+}
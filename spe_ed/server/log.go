@@ -30,6 +30,9 @@ import (
 
 const logPath = "./log/"
 
+// logVersion is the version of the log format. Logs without a version (the first line holds only the players) have version 1.
+const logVersion = 2
+
 var disableLogging = false
 
 func init() {
@@ -39,18 +42,55 @@ func init() {
 	}
 }
 
+// logHeader is the first line of a log.
+type logHeader struct {
+	Version       int               `json:"version"`
+	ID            string            `json:"id"`
+	Start         time.Time         `json:"start"`
+	ServerVersion string            `json:"serverVersion"`
+	Seed          int64             `json:"seed"`
+	Practice      bool              `json:"practice,omitempty"`
+	Rules         Rules             `json:"rules"`
+	Players       map[int]playerLog `json:"players"`
+}
+
 type playerLog struct {
-	APIKey    string
+	APIKey    string // fingerprint of the key, see KeyFingerprint
 	Pseudonym string
 	AI        string
 }
 
+// loggedState is a game state together with the record of the round leading to it. The initial state has no record.
+type loggedState struct {
+	*Game
+	Record *roundLog `json:"record,omitempty"`
+}
+
+// roundLog records what happened in a single round.
+type roundLog struct {
+	Round        int                 `json:"round"`
+	Deadline     string              `json:"deadline,omitempty"` // deadline sent to the players, without grace time
+	Actions      map[int]actionLog   `json:"actions"`            // first answer of each player, players without answer are missing
+	Eliminations map[int]Elimination `json:"eliminations,omitempty"`
+
+	eliminated map[int]bool // players eliminated before the round
+}
+
+// actionLog is an answer of a player.
+type actionLog struct {
+	Action  string `json:"action"`  // as received, might be invalid
+	Latency int64  `json:"latency"` // time between sending the state and receiving the answer in milliseconds
+}
+
 // Logger allows for games to be saved to a lz4-compressed file, thus making them analyseable later.
 type Logger struct {
 	file   *os.File
 	w      *lz4.Writer
 	data   chan []byte
+	done   chan struct{}
 	closed bool
+	id     string
+	record *roundLog
 }
 
 // GetLogger returns a logger and a game name to log a game to. All actions are saved in a lz4-compressed file.
@@ -67,6 +107,7 @@ func GetLogger() (*Logger, string, error) {
 
 	var err error
 	l := new(Logger)
+	l.id = id
 
 	l.file, err = os.Create(filename)
 	if err != nil {
@@ -74,29 +115,43 @@ func GetLogger() (*Logger, string, error) {
 	}
 	l.w = lz4.NewWriter(l.file)
 	l.data = make(chan []byte, 10)
+	l.done = make(chan struct{})
 	go l.worker()
 	return l, id, nil
 }
 
-// LogPlayer writes the player map to the log file.
+// LogStart writes the header containing the players, rules and seed to the log file.
 // Should be called once in the beginning.
-func (l *Logger) LogPlayer(p map[int]*Player) {
-	metadata := make(map[int]playerLog)
+func (l *Logger) LogStart(g *Game) {
+	header := logHeader{
+		Version:       logVersion,
+		ID:            l.id,
+		Start:         time.Now(),
+		ServerVersion: serverVersion,
+		Seed:          g.Seed,
+		Practice:      g.Practice,
+		Rules:         g.Rules,
+		Players:       make(map[int]playerLog, len(g.Players)),
+	}
 
-	for k, v := range p {
+	for k, v := range g.Players {
 		pl := playerLog{
-			APIKey:    v.api,
+			APIKey:    "",
 			Pseudonym: v.realName,
 			AI:        "",
 		}
 
+		if v.api != "" {
+			pl.APIKey = KeyFingerprint(v.api)
+		}
+
 		if v.underlyingAI != nil {
 			pl.AI = v.underlyingAI.Name()
 		}
-		metadata[k] = pl
+		header.Players[k] = pl
 	}
 
-	b, err := json.Marshal(metadata)
+	b, err := json.Marshal(header)
 	if err != nil {
 		log.Println("logger:", err)
 		return
@@ -104,25 +159,69 @@ func (l *Logger) LogPlayer(p map[int]*Player) {
 	l.data <- b
 }
 
-// LogState writes the game state to the log file.
+// StartRound starts recording the current round of the game. Should be called after sending the state of the round.
+// Does nothing if l is nil.
+func (l *Logger) StartRound(g *Game) {
+	if l == nil {
+		return
+	}
+	l.record = &roundLog{Round: g.round, Deadline: g.Deadline, Actions: make(map[int]actionLog), eliminated: make(map[int]bool)}
+	for k, v := range g.Players {
+		if v.Elimination != nil {
+			l.record.eliminated[k] = true
+		}
+	}
+}
+
+// LogAction records an answer of a player in the current round. Only the first answer of each player is recorded.
+// Does nothing if l is nil.
+func (l *Logger) LogAction(player int, action string, latency time.Duration) {
+	if l == nil || l.record == nil {
+		return
+	}
+	if _, ok := l.record.Actions[player]; ok {
+		return
+	}
+	l.record.Actions[player] = actionLog{Action: action, Latency: latency.Milliseconds()}
+}
+
+// EndRound records all players eliminated in the current round. The record is written together with the next state.
+// Does nothing if l is nil.
+func (l *Logger) EndRound(g *Game) {
+	if l == nil || l.record == nil {
+		return
+	}
+	for k, v := range g.Players {
+		if v.Elimination != nil && !l.record.eliminated[k] {
+			if l.record.Eliminations == nil {
+				l.record.Eliminations = make(map[int]Elimination)
+			}
+			l.record.Eliminations[k] = *v.Elimination
+		}
+	}
+}
+
+// LogState writes the game state to the log file, together with the record of the last round (see EndRound).
 func (l *Logger) LogState(g *Game) {
 	if l.closed {
 		log.Println("logger: writing while closed")
 		return
 	}
 
-	b, err := json.Marshal(g)
+	b, err := json.Marshal(loggedState{Game: g, Record: l.record})
 	if err != nil {
 		log.Println("logger:", err)
 	}
+	l.record = nil
 	l.data <- b
 }
 
-// Close closes the log file.
+// Close closes the log file. It returns after all data is written.
 func (l *Logger) Close() {
 	if !l.closed {
 		close(l.data)
 		l.closed = true
+		<-l.done
 	}
 }
 
@@ -150,4 +249,5 @@ func (l *Logger) worker() {
 		l.file.Close()
 	}
 	l.file = nil
+	close(l.done)
 }
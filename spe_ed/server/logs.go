@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Top-Ranger/spe_ed/server/gamelog"
+)
+
+// logsCommand implements the "logs" command line: it prints a summary of logs or a single state of a log.
+func logsCommand(args []string) {
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	dir := fs.String("dir", logPath, "Directory containing the logs. Only used if no logs are given as arguments")
+	round := fs.Int("round", 0, "Prints the state of the given round (starting with 1) of a single log as JSON instead of a summary")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: logs [options] [log files]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *round != 0 {
+		if fs.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, "logs: -round needs exactly one log")
+			os.Exit(2)
+		}
+		s, err := gamelog.ReadRound(fs.Arg(0), *round)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "logs:", err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(s.Raw)
+		fmt.Println()
+		return
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		var err error
+		files, err = gamelog.List(*dir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "logs:", err)
+			os.Exit(1)
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Game\tStart\tDuration\tBoard\tRounds\tWinner\tPlayers")
+	for _, f := range files {
+		s, err := gamelog.Summarise(f)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "logs:", err)
+			if s.Players == nil {
+				continue
+			}
+		}
+		start := "-"
+		if !s.Start.IsZero() {
+			start = s.Start.Local().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%dx%d\t%d\t%s\t%s\n", s.ID, start, s.Duration.Round(time.Second), s.Width, s.Height, s.Rounds, summaryWinner(s), summaryPlayers(s))
+	}
+	w.Flush()
+}
+
+// summaryWinner returns a human readable description of the winner of a game.
+func summaryWinner(s gamelog.Summary) string {
+	switch {
+	case !s.Finished:
+		return "unfinished"
+	case s.Winner == -1:
+		return "draw"
+	case s.Teams != nil:
+		return fmt.Sprintf("team %d", s.Winner)
+	}
+	return fmt.Sprint(s.Winner)
+}
+
+// summaryPlayers returns a human readable list of all players of a game, e.g. "1:SnailAI 2:Some Pseudonym".
+func summaryPlayers(s gamelog.Summary) string {
+	ids := make([]int, 0, len(s.Players))
+	for k := range s.Players {
+		ids = append(ids, k)
+	}
+	sort.Ints(ids)
+
+	list := make([]string, len(ids))
+	for i, k := range ids {
+		p := s.Players[k]
+		name := p.Pseudonym
+		if p.AI != "" {
+			name = p.AI
+		}
+		if s.Teams != nil {
+			list[i] = fmt.Sprintf("%d:%s (team %d)", k, name, s.Teams[k])
+			continue
+		}
+		list[i] = fmt.Sprintf("%d:%s", k, name)
+	}
+	return strings.Join(list, " ")
+}
@@ -54,7 +54,13 @@ var (
 	serverAddress = "localhost:10101"
 	statsEnabled  bool
 	keyFile       = "./keys"
+	secretFile    = "./fingerprintsecret"
 	pseudonymFile = "./pseudonyms"
+	ratingFile    = "./ratings"
+	resultFile    = "./results"
+
+	// serverVersion is written to the logs. It can be set while building, e.g. go build -ldflags "-X main.serverVersion=v1.0.0"
+	serverVersion = "development"
 )
 
 func init() {
@@ -63,23 +69,103 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "simulate":
+			simulateCommand(os.Args[2:])
+			return
+		case "logs":
+			logsCommand(os.Args[2:])
+			return
+		}
+	}
+
 	flag.BoolVar(&disableLogging, "disableLogging", false, "Disables logging of games")
 	wait := flag.String("wait", "5m", "Waiting time for new games. Must be at least 0s (0=instant start for debugging). Value must be parseable by time.Duration")
 	flag.BoolVar(&disableTime, "disableTime", false, "Disables time endpoint")
+	flag.Int64Var(&gameSeed, "seed", 0, "Seed used for all games. Games with the same seed and the same actions are identical. 0 means a random seed for each game")
 	flag.StringVar(&serverAddress, "address", serverAddress, "Address of the server")
 	flag.BoolVar(&statsEnabled, "stats", false, "Enables stats on /spe_ed_stats")
+	flag.BoolVar(&watchEnabled, "watch", false, "Enables spectators on /spe_ed_watch")
+	watchdelay := flag.String("watchdelay", "10s", "Delay of the states sent to spectators. Must be at least 0s. Value must be parseable by time.Duration")
 	flag.StringVar(&keyFile, "keyfile", keyFile, "Path to key file")
+	flag.StringVar(&secretFile, "fingerprintsecret", secretFile, "Path to the file containing the secret of the key fingerprints shown in logs and used by challenges and tournaments. Will be created if non-existing and must be kept private")
 	flag.StringVar(&pseudonymFile, "pseudonymfile", pseudonymFile, "Path to pseudonym file. Will be created if non-existing")
-	ais := flag.String("ais", "", fmt.Sprintf("Comma seperated list of ais which should be used. Must be at least %d", PlayersPerGame))
+	flag.StringVar(&ratingFile, "ratingfile", ratingFile, "Path to rating file. Will be created if non-existing")
+	flag.StringVar(&resultFile, "resultfile", resultFile, "Path to file storing the results of all games. Will be created if non-existing")
+	flag.BoolVar(&leaderboardEnabled, "leaderboard", false, "Enables leaderboard on /spe_ed_leaderboard (HTML) and /spe_ed_leaderboard.json")
+	leaderboardwindow := flag.String("leaderboardwindow", "720h", "Default time window of the leaderboard. Must be at least 0s (0=all results). Value must be parseable by time.Duration")
+	flag.IntVar(&PlayersPerGame, "players", PlayersPerGame, fmt.Sprintf("Maximum number of players per game. Must be between 2 and %d", MaxPlayersPerGame))
+	ais := flag.String("ais", "", "Comma seperated list of ais which should be used. Must be at least the maximum number of players per game")
 	listais := flag.Bool("listais", false, "Lists all ai names and exits")
+	hashkey := flag.String("hashkey", "", "Prints a key file entry containing a salted hash of the given key and exits")
+	fingerprint := flag.String("fingerprint", "", "Prints the fingerprint of the given key (e.g. for tournament definitions) and exits")
 	logfilename := flag.String("logfile", "", "If set, logging will be done to file instead of to stdout")
+	roomfile := flag.String("roomfile", "", "Path to a JSON file containing a list of rooms. If not set, only the default room is created from -wait, -players and -seed")
+	admintokenfile := flag.String("admintokenfile", "", "Path to a file containing the admin token. If set, the admin API is enabled on /spe_ed_admin/")
+	adminauditlog := flag.String("adminauditlog", "./admin.log", "Path to the audit log of the admin API")
+	tournamentfile := flag.String("tournament", "", "Path to a JSON file containing a tournament definition. If set, the tournament is started and its standings are available on /spe_ed_tournament (HTML) and /spe_ed_tournament.json")
+	flag.IntVar(&FieldMinSize, "fieldminsize", FieldMinSize, "Minimum size of the field (both width and height)")
+	flag.IntVar(&FieldMaxSize, "fieldmaxsize", FieldMaxSize, "Maximum size of the field (both width and height). Must be larger than -fieldminsize")
+	flag.IntVar(&MaxSpeed, "maxspeed", MaxSpeed, "Maximum speed of a player")
+	flag.IntVar(&HolesEachStep, "holeseachstep", HolesEachStep, "Number of steps after which a hole might occur")
+	flag.IntVar(&HoleSpeed, "holespeed", HoleSpeed, "Minimum speed needed for a hole")
+	flag.IntVar(&RoundTimeoutMin, "roundtimeoutmin", RoundTimeoutMin, "Minimum time of a round (in seconds)")
+	flag.IntVar(&RoundTimeoutMax, "roundtimeoutmax", RoundTimeoutMax, "Maximum time of a round (in seconds)")
+	flag.IntVar(&RoundTimeoutGrace, "roundtimeoutgrace", RoundTimeoutGrace, "Time after the deadline in which answers are still accepted (in seconds)")
+	flag.BoolVar(&Torus, "torus", Torus, "Players leaving the board enter it on the opposite side instead of being eliminated")
+	flag.StringVar(&MapName, "map", MapName, "Map of all games: name of a map in -mapdir, 'random' for a random map or empty for an empty board of random size")
+	flag.IntVar(&ObstacleDensity, "obstacledensity", ObstacleDensity, fmt.Sprintf("Percentage of cells covered by randomly generated obstacles. Must be between 0 and %d", MaxObstacleDensity))
+	flag.IntVar(&SuddenDeathRound, "suddendeathround", SuddenDeathRound, "Number of rounds after which sudden death starts and free cells are filled. 0 disables sudden death")
+	flag.StringVar(&SuddenDeathMode, "suddendeathmode", SuddenDeathMode, "How free cells are filled during sudden death: 'ring' fills the board ring by ring from the outside, 'blocks' adds random blocks")
+	flag.IntVar(&SuddenDeathInterval, "suddendeathinterval", SuddenDeathInterval, "Number of rounds between filling cells during sudden death")
+	flag.IntVar(&TeamSize, "teamsize", TeamSize, "Number of players per team (e.g. 2 for 2v2). Players join a team with the parameter 'team'. 0 or 1 means that every player plays alone")
+	flag.IntVar(&TrainingTimeoutMin, "trainingtimeoutmin", TrainingTimeoutMin, "Minimum time of a round in training games (in milliseconds)")
+	flag.IntVar(&TrainingTimeoutMax, "trainingtimeoutmax", TrainingTimeoutMax, "Maximum time of a round in training games (in milliseconds)")
+	flag.IntVar(&TrainingTimeoutGrace, "trainingtimeoutgrace", TrainingTimeoutGrace, "Time after the deadline in which answers are still accepted in training games (in milliseconds)")
+	flag.IntVar(&NumberTrainingGames, "traininggames", NumberTrainingGames, fmt.Sprintf("Number of training games a key can participate in at the same time. Must be between 0 and %d. Training games are requested with the parameter 'training' containing a comma separated list of ais", MaxTrainingGames))
+	mapdir := flag.String("mapdir", "", "Path to a directory containing maps (files ending in .json). Maps can be selected by -map or by the rules of a room")
+	flag.IntVar(&NumberAllowedGames, "allowedgames", NumberAllowedGames, "Number of games a key can participate in at the same time")
+	flag.DurationVar(&PseudonymUpdateInterval, "pseudonyminterval", PseudonymUpdateInterval, "Interval at which pseudonyms are updated")
+	config := flag.String("config", "", "Path to a JSON configuration file mapping option names (as listed here, without '-') to values. Options given on the command line take precedence")
 	flag.Parse()
 
+	if *config != "" {
+		err := LoadConfig(*config, flag.CommandLine)
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	if *listais {
 		fmt.Println(GetAINames())
 		return
 	}
 
+	if *hashkey != "" {
+		entry, err := HashKey(*hashkey)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(entry)
+		return
+	}
+
+	InitFingerprints(secretFile)
+
+	if *fingerprint != "" {
+		fmt.Println(KeyFingerprint(*fingerprint))
+		return
+	}
+
+	if *mapdir != "" {
+		InitMaps(*mapdir)
+	}
+
+	if err := ValidateSettings(); err != nil {
+		panic(err)
+	}
+
 	if *ais != "" {
 		err := UpdateAIPool(strings.Split(*ais, ","))
 		if err != nil {
@@ -87,6 +173,10 @@ func main() {
 		}
 	}
 
+	if AIPoolSize() < PlayersPerGame {
+		panic(fmt.Sprintf("ai pool must contain at least %d ais", PlayersPerGame))
+	}
+
 	{
 		var err error
 		maxWaitTime, err = time.ParseDuration(*wait)
@@ -97,6 +187,24 @@ func main() {
 		if maxWaitTime < 0 {
 			panic("waiting time too small")
 		}
+
+		watchDelay, err = time.ParseDuration(*watchdelay)
+
+		if err != nil {
+			panic(err)
+		}
+		if watchDelay < 0 {
+			panic("watch delay too small")
+		}
+
+		leaderboardWindow, err = time.ParseDuration(*leaderboardwindow)
+
+		if err != nil {
+			panic(err)
+		}
+		if leaderboardWindow < 0 {
+			panic("leaderboard window too small")
+		}
 	}
 
 	if *logfilename == "" {
@@ -112,8 +220,15 @@ func main() {
 
 	InitPseudonyms(pseudonymFile)
 	InitKeys(keyFile)
+	InitRatings(ratingFile)
+	InitResults(resultFile)
+	InitRooms(*roomfile)
+	if *tournamentfile != "" {
+		InitTournament(*tournamentfile)
+	}
 
 	http.HandleFunc("/spe_ed", endpoint)
+	http.HandleFunc("/spe_ed_challenge", challengeEndpoint)
 
 	if statsEnabled {
 		InitStats()
@@ -129,6 +244,25 @@ func main() {
 		})
 	}
 
+	if watchEnabled {
+		http.HandleFunc("/spe_ed_watch", watchEndpoint)
+	}
+
+	if *admintokenfile != "" {
+		InitAdmin(*admintokenfile, *adminauditlog)
+		http.HandleFunc("/spe_ed_admin/", adminEndpoint)
+	}
+
+	if tournament != nil {
+		http.HandleFunc("/spe_ed_tournament", tournamentEndpoint)
+		http.HandleFunc("/spe_ed_tournament.json", tournamentJSONEndpoint)
+	}
+
+	if leaderboardEnabled {
+		http.HandleFunc("/spe_ed_leaderboard", leaderboardEndpoint)
+		http.HandleFunc("/spe_ed_leaderboard.json", leaderboardJSONEndpoint)
+	}
+
 	if !disableTime {
 		http.HandleFunc("/spe_ed_time", func(rw http.ResponseWriter, r *http.Request) {
 			now := time.Now().UTC()
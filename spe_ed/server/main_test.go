@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	golog "log"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	log = golog.New(ioutil.Discard, "", 0)
+	if testing.Verbose() {
+		log = golog.New(os.Stderr, "spe_ed test ", golog.LstdFlags)
+	}
+	// Tests must not write game logs
+	disableLogging = true
+	// Fingerprints do not depend on a secret file
+	fingerprintSecret = []byte("spe_ed test fingerprint secret")
+	// Pseudonyms are kept in memory only
+	GlobalPseudonym.Dict = make(map[string]string)
+	os.Exit(m.Run())
+}
+
+// useKeys replaces all API keys by the given plain keys for a test and restores them afterwards.
+func useKeys(t *testing.T, keys ...string) {
+	t.Helper()
+	keymapLock.Lock()
+	defer keymapLock.Unlock()
+
+	oldKeymap, oldHashed, oldResolved, oldRevoked, oldClaims, oldTraining, oldConnections := keymap, hashedKeys, resolvedKeys, revokedKeys, keyClaims, trainingClaims, connections
+	keymap = make(map[string]int)
+	for _, k := range keys {
+		keymap[k] = NumberAllowedGames
+	}
+	hashedKeys = nil
+	resolvedKeys = make(map[string]string)
+	revokedKeys = make(map[string]int)
+	keyClaims = make(map[string]map[uint64]bool)
+	trainingClaims = make(map[string]map[uint64]bool)
+	connections = make(map[string]map[*Player]bool)
+
+	t.Cleanup(func() {
+		keymapLock.Lock()
+		defer keymapLock.Unlock()
+		keymap, hashedKeys, resolvedKeys, revokedKeys, keyClaims, trainingClaims, connections = oldKeymap, oldHashed, oldResolved, oldRevoked, oldClaims, oldTraining, oldConnections
+	})
+}
+
+// usePseudonyms replaces all pseudonyms for a test and restores them afterwards.
+func usePseudonyms(t *testing.T, dict map[string]string) {
+	t.Helper()
+	GlobalPseudonym.l.Lock()
+	defer GlobalPseudonym.l.Unlock()
+
+	old := GlobalPseudonym.Dict
+	GlobalPseudonym.Dict = dict
+	t.Cleanup(func() {
+		GlobalPseudonym.l.Lock()
+		defer GlobalPseudonym.l.Unlock()
+		GlobalPseudonym.Dict = old
+	})
+}
+
+// waitFor polls condition until it is true. The test fails if this takes longer than a few seconds.
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	for i := 0; !condition(); i++ {
+		if i == 500 {
+			t.Fatal("timeout waiting for", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,284 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// CellObstacle is the value of a cell containing an obstacle.
+	CellObstacle int8 = -2
+	// MapRandom selects a random map out of all loaded maps which are large enough for the game.
+	MapRandom = "random"
+	// MaxObstacleDensity is the maximum percentage of cells covered by generated obstacles.
+	MaxObstacleDensity = 50
+)
+
+// Spawn is a fixed starting point of a player. If Direction is empty, it is chosen like on maps without spawn points.
+type Spawn struct {
+	X         int    `json:"x"`
+	Y         int    `json:"y"`
+	Direction string `json:"direction"`
+}
+
+// Map is a board with obstacles. Each row contains one character per cell, '#' is an obstacle and '.' is a free cell.
+// If Spawns is empty, players start at random free cells.
+type Map struct {
+	Name   string   `json:"-"` // Name of the file without extension
+	Rows   []string `json:"rows"`
+	Spawns []Spawn  `json:"spawns"`
+}
+
+var (
+	mapsLock sync.RWMutex
+	maps     = make(map[string]*Map)
+)
+
+// InitMaps loads all maps (files ending in ".json") from a directory.
+// Not safe to be used in parallel with other map functions.
+func InitMaps(dir string) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		panic(err)
+	}
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			panic(err)
+		}
+		m := new(Map)
+		err = json.Unmarshal(b, m)
+		if err != nil {
+			panic(fmt.Errorf("map %s: %w", f, err))
+		}
+		m.Name = strings.TrimSuffix(filepath.Base(f), filepath.Ext(f))
+		err = m.validate()
+		if err != nil {
+			panic(err)
+		}
+		maps[m.Name] = m
+	}
+}
+
+// GetMap returns the map with the given name or nil if it does not exist.
+func GetMap(name string) *Map {
+	mapsLock.RLock()
+	defer mapsLock.RUnlock()
+	return maps[name]
+}
+
+// GetMapNames returns the names of all loaded maps.
+func GetMapNames() []string {
+	mapsLock.RLock()
+	defer mapsLock.RUnlock()
+	s := make([]string, 0, len(maps))
+	for k := range maps {
+		s = append(s, k)
+	}
+	sort.Strings(s)
+	return s
+}
+
+// Width returns the width of the map.
+func (m *Map) Width() int {
+	if len(m.Rows) == 0 {
+		return 0
+	}
+	return len(m.Rows[0])
+}
+
+// Height returns the height of the map.
+func (m *Map) Height() int {
+	return len(m.Rows)
+}
+
+// Fits returns whether a game with the given number of players can be played on the map.
+func (m *Map) Fits(players int) bool {
+	if len(m.Spawns) != 0 {
+		return len(m.Spawns) >= players
+	}
+	areasX, areasY := spawnAreas(players)
+	return m.Width() >= areasX && m.Height() >= areasY
+}
+
+// validate checks the map for consistency.
+func (m *Map) validate() error {
+	if m.Name == MapRandom {
+		return fmt.Errorf("map %s: name is reserved", m.Name)
+	}
+	if m.Height() == 0 || m.Width() == 0 {
+		return fmt.Errorf("map %s: empty map", m.Name)
+	}
+	for y := range m.Rows {
+		if len(m.Rows[y]) != m.Width() {
+			return fmt.Errorf("map %s: row %d has length %d, expected %d", m.Name, y, len(m.Rows[y]), m.Width())
+		}
+		for x := range m.Rows[y] {
+			if m.Rows[y][x] != '#' && m.Rows[y][x] != '.' {
+				return fmt.Errorf("map %s: unknown cell '%c' at %d,%d", m.Name, m.Rows[y][x], x, y)
+			}
+		}
+	}
+	used := make(map[struct{ X, Y int }]bool, len(m.Spawns))
+	for _, s := range m.Spawns {
+		if s.X < 0 || s.X >= m.Width() || s.Y < 0 || s.Y >= m.Height() || m.Rows[s.Y][s.X] != '.' {
+			return fmt.Errorf("map %s: spawn %d,%d is not a free cell", m.Name, s.X, s.Y)
+		}
+		if used[struct{ X, Y int }{s.X, s.Y}] {
+			return fmt.Errorf("map %s: spawn %d,%d is used twice", m.Name, s.X, s.Y)
+		}
+		used[struct{ X, Y int }{s.X, s.Y}] = true
+		switch s.Direction {
+		case "", DirectionUp, DirectionDown, DirectionLeft, DirectionRight:
+		default:
+			return fmt.Errorf("map %s: spawn %d,%d has unknown direction %s", m.Name, s.X, s.Y, s.Direction)
+		}
+	}
+	return nil
+}
+
+// cells returns the cells of the map.
+func (m *Map) cells() [][]int8 {
+	c := make([][]int8, m.Height())
+	for y := range c {
+		c[y] = make([]int8, m.Width())
+		for x := range c[y] {
+			if m.Rows[y][x] == '#' {
+				c[y][x] = CellObstacle
+			}
+		}
+	}
+	return c
+}
+
+// validateMap checks whether the map of the rules can be used for games with up to maxPlayers players.
+func validateMap(name string, maxPlayers int) error {
+	switch name {
+	case "":
+		return nil
+	case MapRandom:
+		mapsLock.RLock()
+		defer mapsLock.RUnlock()
+		for _, m := range maps {
+			if m.Fits(maxPlayers) {
+				return nil
+			}
+		}
+		return fmt.Errorf("no map for %d players loaded", maxPlayers)
+	}
+	m := GetMap(name)
+	if m == nil {
+		return fmt.Errorf("unknown map %s", name)
+	}
+	if !m.Fits(maxPlayers) {
+		return fmt.Errorf("map %s is too small for %d players", name, maxPlayers)
+	}
+	return nil
+}
+
+// selectMap returns the map of the game according to the rules or nil if an empty board of random size should be used.
+// Caller has to lock the game.
+func (g *Game) selectMap() *Map {
+	switch g.Rules.Map {
+	case "":
+		return nil
+	case MapRandom:
+		candidates := make([]*Map, 0)
+		for _, name := range GetMapNames() {
+			if m := GetMap(name); m.Fits(g.numberPlayer) {
+				candidates = append(candidates, m)
+			}
+		}
+		if len(candidates) == 0 {
+			log.Println("game:", "no map for", g.numberPlayer, "players, using empty board")
+			return nil
+		}
+		return candidates[g.rng.Intn(len(candidates))]
+	}
+	m := GetMap(g.Rules.Map)
+	if m == nil || !m.Fits(g.numberPlayer) {
+		log.Println("game:", "map", g.Rules.Map, "not usable, using empty board")
+		return nil
+	}
+	return m
+}
+
+// freeCell returns a random free cell in the given area of the board. If the area is full, any free cell of the board is returned.
+// On boards without obstacles, only a single random cell is drawn, so games stay reproducible by their seed.
+// Caller has to lock the game.
+func (g *Game) freeCell(areaX, areaY, areaWidth, areaHeight int) (int, int) {
+	for try := 0; try < 100; try++ {
+		x := areaX + g.rng.Intn(areaWidth)
+		y := areaY + g.rng.Intn(areaHeight)
+		if g.Cells[y][x] == 0 {
+			return x, y
+		}
+	}
+	for y := areaY; y < areaY+areaHeight; y++ {
+		for x := areaX; x < areaX+areaWidth; x++ {
+			if g.Cells[y][x] == 0 {
+				return x, y
+			}
+		}
+	}
+	for y := range g.Cells {
+		for x := range g.Cells[y] {
+			if g.Cells[y][x] == 0 {
+				return x, y
+			}
+		}
+	}
+	return areaX, areaY
+}
+
+// generateObstacles covers about Rules.ObstacleDensity percent of the board with random blocks of obstacles.
+// Cells near the starting positions of the players are kept free. Must be called after all players are placed.
+// Caller has to lock the game.
+func (g *Game) generateObstacles() {
+	const startDistance = 3
+
+	nearStart := func(x, y int) bool {
+		for _, p := range g.Players {
+			dx, dy := p.X-x, p.Y-y
+			if dx >= -startDistance && dx <= startDistance && dy >= -startDistance && dy <= startDistance {
+				return true
+			}
+		}
+		return false
+	}
+
+	target := g.Width * g.Height * g.Rules.ObstacleDensity / 100
+	placed := 0
+	for try := 0; placed < target && try < 100*(target+1); try++ {
+		w, h := g.rng.Intn(4)+1, g.rng.Intn(4)+1
+		bx, by := g.rng.Intn(g.Width), g.rng.Intn(g.Height)
+		for y := by; y < by+h && y < g.Height && placed < target; y++ {
+			for x := bx; x < bx+w && x < g.Width && placed < target; x++ {
+				if g.Cells[y][x] == 0 && !nearStart(x, y) {
+					g.Cells[y][x] = CellObstacle
+					placed++
+				}
+			}
+		}
+	}
+}
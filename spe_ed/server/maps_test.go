@@ -0,0 +1,207 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// useMaps replaces all maps for a test and restores them afterwards.
+func useMaps(t *testing.T, list ...*Map) {
+	t.Helper()
+	mapsLock.Lock()
+	defer mapsLock.Unlock()
+
+	old := maps
+	maps = make(map[string]*Map, len(list))
+	for _, m := range list {
+		maps[m.Name] = m
+	}
+	t.Cleanup(func() {
+		mapsLock.Lock()
+		defer mapsLock.Unlock()
+		maps = old
+	})
+}
+
+// initialisedGame returns a game between the AIs which is set up for the first round.
+func initialisedGame(t *testing.T, seed int64, rules Rules, ais ...string) *Game {
+	t.Helper()
+	g := NewGame(seed, len(ais), len(ais))
+	g.Rules = rules
+	err := g.AddNamedAI(ais)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.l.Lock()
+	defer g.l.Unlock()
+	g.initialise()
+	return g
+}
+
+func TestInitMaps(t *testing.T) {
+	useMaps(t)
+	InitMaps("maps")
+	if names := GetMapNames(); !reflect.DeepEqual(names, []string{"arena", "cross"}) {
+		t.Errorf("got maps %v", names)
+	}
+	if m := GetMap("arena"); m == nil || m.Name != "arena" || m.Width() == 0 {
+		t.Errorf("got map %+v", m)
+	}
+
+	dir := filepath.Dir(tempFile(t, "broken.json", `{"rows": ["..", "."]}`))
+	defer func() {
+		if recover() == nil {
+			t.Error("invalid map accepted")
+		}
+	}()
+	InitMaps(dir)
+}
+
+func TestMapValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		m    Map
+		err  string // empty if the map is valid
+	}{
+		{"valid", Map{Name: "m", Rows: []string{"..#", "..."}, Spawns: []Spawn{{0, 0, DirectionUp}, {2, 1, ""}}}, ""},
+		{"reserved name", Map{Name: MapRandom, Rows: []string{"."}}, "reserved"},
+		{"empty", Map{Name: "m"}, "empty map"},
+		{"row length", Map{Name: "m", Rows: []string{"...", ".."}}, "row 1"},
+		{"unknown cell", Map{Name: "m", Rows: []string{".x."}}, "unknown cell 'x'"},
+		{"spawn outside", Map{Name: "m", Rows: []string{"..."}, Spawns: []Spawn{{3, 0, ""}}}, "not a free cell"},
+		{"spawn on obstacle", Map{Name: "m", Rows: []string{".#."}, Spawns: []Spawn{{1, 0, ""}}}, "not a free cell"},
+		{"spawn twice", Map{Name: "m", Rows: []string{"..."}, Spawns: []Spawn{{1, 0, ""}, {1, 0, ""}}}, "used twice"},
+		{"spawn direction", Map{Name: "m", Rows: []string{"..."}, Spawns: []Spawn{{1, 0, "north"}}}, "unknown direction"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.m.validate()
+			if tt.err == "" {
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidateMap(t *testing.T) {
+	small := &Map{Name: "small", Rows: []string{"....", "...."}}
+	spawns := &Map{Name: "spawns", Rows: []string{"......"}, Spawns: []Spawn{{0, 0, ""}, {5, 0, ""}}}
+	useMaps(t, small, spawns)
+
+	tests := []struct {
+		name    string
+		players int
+		err     string // empty if the map can be used
+	}{
+		{"", 6, ""},
+		{"small", 2, ""},
+		{"small", 9, "too small"},
+		{"spawns", 2, ""},
+		{"spawns", 3, "too small"},
+		{MapRandom, 8, ""},
+		{MapRandom, 9, "no map for 9 players"},
+		{"unknown", 2, "unknown map"},
+	}
+	for _, tt := range tests {
+		err := validateMap(tt.name, tt.players)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("map %q, %d players: %v", tt.name, tt.players, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("map %q, %d players: got error %v, want %q", tt.name, tt.players, err, tt.err)
+		}
+	}
+}
+
+func TestGameMap(t *testing.T) {
+	m := &Map{Name: "m", Rows: []string{"#.....", "......", ".....#"}, Spawns: []Spawn{{1, 0, DirectionRight}, {4, 2, ""}}}
+	useMaps(t, m)
+	rules := TrainingRules()
+	rules.Map = "m"
+
+	g := initialisedGame(t, 1, rules, "SnailAI", "StupidAI")
+	if g.Width != 6 || g.Height != 3 || g.Cells[0][0] != CellObstacle || g.Cells[2][5] != CellObstacle {
+		t.Fatalf("got board %dx%d %v", g.Width, g.Height, g.Cells)
+	}
+	for i, p := range g.Players {
+		switch {
+		case p.X == 1 && p.Y == 0:
+			if p.Direction != DirectionRight {
+				t.Errorf("player %d: got direction %s, want fixed direction", i, p.Direction)
+			}
+		case p.X == 4 && p.Y == 2:
+			if p.Direction != startDirection(g, 4, 2) {
+				t.Errorf("player %d: got direction %s", i, p.Direction)
+			}
+		default:
+			t.Errorf("player %d does not start at a spawn point: %d,%d", i, p.X, p.Y)
+		}
+		if g.Cells[p.Y][p.X] != int8(i) {
+			t.Errorf("player %d: start cell not marked", i)
+		}
+	}
+
+	// Maps which are too small are replaced by an empty board
+	g = initialisedGame(t, 1, rules, "SnailAI", "StupidAI", "SnailAI")
+	if g.Rules.Map != "" {
+		t.Errorf("got map %q", g.Rules.Map)
+	}
+}
+
+func TestGenerateObstacles(t *testing.T) {
+	rules := TrainingRules()
+	rules.FieldMinSize = 20
+	rules.FieldMaxSize = 30
+	rules.ObstacleDensity = 20
+
+	g := initialisedGame(t, 7, rules, "SnailAI", "StupidAI")
+	obstacles := 0
+	for y := range g.Cells {
+		for x := range g.Cells[y] {
+			if g.Cells[y][x] != CellObstacle {
+				continue
+			}
+			obstacles++
+			for i, p := range g.Players {
+				if x >= p.X-3 && x <= p.X+3 && y >= p.Y-3 && y <= p.Y+3 {
+					t.Errorf("obstacle %d,%d next to start of player %d", x, y, i)
+				}
+			}
+		}
+	}
+	if want := g.Width * g.Height * rules.ObstacleDensity / 100; obstacles != want {
+		t.Errorf("got %d obstacles, want %d", obstacles, want)
+	}
+
+	// The same seed generates the same board
+	other := initialisedGame(t, 7, rules, "SnailAI", "StupidAI")
+	if !reflect.DeepEqual(g.Cells, other.Cells) {
+		t.Error("same seed generates different boards")
+	}
+}
@@ -43,6 +43,10 @@ type Player struct {
 	Speed     int    `json:"speed"`
 	Active    bool   `json:"active"`
 	Name      string `json:"name,omitempty"`
+	Team      int    `json:"team,omitempty"` // only set if the game is played in teams
+
+	// Why and when the player was eliminated, nil for active players
+	Elimination *Elimination `json:"elimination,omitempty"`
 
 	// To know where wholes need to be
 	stepCounter int
@@ -53,9 +57,14 @@ type Player struct {
 	// Real name - use after game has finished
 	realName string
 
+	// Name of the team requested by the player, players with the same team name play in the same team
+	teamName string
+
 	// API key
 	api         string
+	apiClaim    uint64 // token of the claim of the key, see ClaimKey
 	apiReleased bool
+	training    bool // key was claimed by ClaimTrainingKey
 
 	// Websocket
 	inputLock  sync.Mutex
@@ -64,6 +73,10 @@ type Player struct {
 	ws         *websocket.Conn
 	wsclosed   bool
 	workerOnce sync.Once
+
+	// Closed when readWorker stops, see Lost
+	lost     chan struct{}
+	lostOnce sync.Once
 }
 
 func (p *Player) readWorker() {
@@ -72,6 +85,7 @@ func (p *Player) readWorker() {
 			close(p.Input)
 			p.Input = nil
 		}
+		close(p.lostChannel())
 	}()
 
 	alreadystarted := true
@@ -95,7 +109,7 @@ func (p *Player) readWorker() {
 			p.writerLock.Lock()
 			if !p.wsclosed {
 				// Ok, it is not just closed
-				log.Println("player read error:", p.api, "-", err)
+				log.Println("player read error:", KeyFingerprint(p.api), "-", err)
 			}
 			if websocket.IsUnexpectedCloseError(err) {
 				p.wsclosed = true
@@ -112,7 +126,7 @@ func (p *Player) readWorker() {
 			p.writerLock.Lock()
 			if !p.wsclosed {
 				// Ok, it is not just closed
-				log.Println("player json error:", p.api, "-", err, "-", string(b))
+				log.Println("player json error:", KeyFingerprint(p.api), "-", err, "-", string(b))
 			}
 			p.writerLock.Unlock()
 			return
@@ -128,6 +142,18 @@ func (p *Player) readWorker() {
 	}
 }
 
+// Lost returns a channel which is closed as soon as no more actions are read from the websocket of the player,
+// e.g. because the connection was lost or the player was closed.
+func (p *Player) Lost() <-chan struct{} {
+	return p.lostChannel()
+}
+
+// lostChannel returns the channel returned by Lost, creating it if needed.
+func (p *Player) lostChannel() chan struct{} {
+	p.lostOnce.Do(func() { p.lost = make(chan struct{}) })
+	return p.lost
+}
+
 // WriteState sends the given state to the player, either to the websocket or by calling the corresponding AI function.
 func (p *Player) WriteState(g *Game) error {
 	p.writerLock.Lock()
@@ -180,6 +206,9 @@ func (p *Player) Close() error {
 
 	err := p.ws.Close()
 	p.wsclosed = true
+	if p.api != "" {
+		go unregisterConnection(p)
+	}
 	go p.ReleaseAPI()
 	p.ws = nil
 	return err
@@ -193,6 +222,10 @@ func (p *Player) ReleaseAPI() {
 
 	if !p.apiReleased && p.api != "" {
 		p.apiReleased = true
-		ReleaseKey(p.api)
+		if p.training {
+			ReleaseTrainingKey(p.api, p.apiClaim)
+		} else {
+			ReleaseKey(p.api, p.apiClaim)
+		}
 	}
 }
@@ -25,18 +25,17 @@ import (
 	"time"
 )
 
-const (
-	// PseudonymUpdateInterval is the interval at which pseudonyms will be updated.
-	PseudonymUpdateInterval = 336 * time.Hour // 14 days
-)
+// PseudonymUpdateInterval is the interval at which pseudonyms will be updated.
+var PseudonymUpdateInterval = 336 * time.Hour // 14 days
 
 // Pseudonym represents the current pseudonyms used by the server.
-// The pseudonyms will regularily be saved to the disc to "./pseudonyms".
+// The pseudonyms will regularily be saved to the disc to the file given to InitPseudonyms.
 // The pseudonyms will automatically be updated.
 type Pseudonym struct {
 	LastUpdated time.Time
 	Dict        map[string]string
 	l           sync.Mutex
+	filename    string
 }
 
 // GlobalPseudonym is the global instance of Pseudonym
@@ -45,6 +44,7 @@ var GlobalPseudonym Pseudonym
 // InitPseudonyms initialises the global instance of Pseudonym.
 // Not safe to be used in parallel with other pseudonym functions.
 func InitPseudonyms(filename string) {
+	GlobalPseudonym.filename = filename
 	// Load Pseudonyms
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
 		GlobalPseudonym.Dict = make(map[string]string)
@@ -59,10 +59,32 @@ func InitPseudonyms(filename string) {
 		if err != nil {
 			panic(err)
 		}
+		GlobalPseudonym.migrateKeys()
 		go GlobalPseudonym.worker()
 	}
 }
 
+// migrateKeys replaces plain API keys (used by older versions of the server) with their fingerprints (see KeyFingerprint),
+// so teams keep their pseudonym and no keys are stored in the pseudonym file.
+// Not safe to be used in parallel with other pseudonym functions.
+func (p *Pseudonym) migrateKeys() {
+	migrated := 0
+	for k, v := range p.Dict {
+		if strings.HasPrefix(k, "AI-") || IsKeyFingerprint(k) {
+			continue
+		}
+		f := KeyFingerprint(k)
+		if _, ok := p.Dict[f]; !ok {
+			p.Dict[f] = v
+		}
+		delete(p.Dict, k)
+		migrated++
+	}
+	if migrated != 0 {
+		log.Println("pseudonym:", "migrated", migrated, "keys to fingerprints")
+	}
+}
+
 // NewPseudonym returns a new random pseudonym.
 func NewPseudonym() string {
 	words := make([]string, 3)
@@ -86,7 +108,7 @@ func (p *Pseudonym) worker() {
 		if err != nil {
 			log.Println("pseudonym:", "marshal", err)
 		} else {
-			err = ioutil.WriteFile("./pseudonyms", b, os.ModePerm)
+			err = ioutil.WriteFile(p.filename, b, os.ModePerm)
 			if err != nil {
 				log.Println("pseudonym:", "writing file", err)
 			}
@@ -97,6 +119,18 @@ func (p *Pseudonym) worker() {
 	}
 }
 
+// Lookup returns the string (e.g. key fingerprint) the pseudonym currently belongs to.
+func (p *Pseudonym) Lookup(pseudonym string) (string, bool) {
+	p.l.Lock()
+	defer p.l.Unlock()
+	for k, v := range p.Dict {
+		if v == pseudonym {
+			return k, true
+		}
+	}
+	return "", false
+}
+
 // Get returns the current pseudonym for a given string (e.g. player API key or AI name).
 // It will create a new one if the string has no previous pseudonym associated with it.
 func (p *Pseudonym) Get(API string) string {
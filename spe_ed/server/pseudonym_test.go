@@ -0,0 +1,40 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPseudonymMigrateKeys(t *testing.T) {
+	p := Pseudonym{Dict: map[string]string{
+		"plain":               "Plain-Team-Name",
+		"old":                 "Old-Team-Name",
+		KeyFingerprint("old"): "New-Team-Name",
+		"AI-SnailAI":          "Snail-Name",
+	}}
+	p.migrateKeys()
+
+	want := map[string]string{
+		KeyFingerprint("plain"): "Plain-Team-Name",
+		KeyFingerprint("old"):   "New-Team-Name",
+		"AI-SnailAI":            "Snail-Name",
+	}
+	if !reflect.DeepEqual(p.Dict, want) {
+		t.Errorf("got %v, want %v", p.Dict, want)
+	}
+}
@@ -0,0 +1,219 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// RatingInitial is the rating of a key or AI without any games.
+	RatingInitial = 1500.0
+	// RatingK is the maximum change of a rating in a single game.
+	RatingK = 32.0
+	// RatingSaveInterval is the interval at which changed ratings are saved.
+	RatingSaveInterval = 1 * time.Minute
+)
+
+// Rating holds the skill rating of a single API key or AI.
+type Rating struct {
+	Rating   float64
+	Games    int
+	LastGame time.Time
+}
+
+// RatingEntry is a rating together with the name it belongs to, as shown on the stats page.
+type RatingEntry struct {
+	Name string
+	AI   bool
+	Rating
+}
+
+// RatingResult is the result of a single player in a game.
+// Name is the fingerprint of the API key of the player (see KeyFingerprint) or the name of the AI.
+type RatingResult struct {
+	Name  string
+	AI    bool
+	Place int
+}
+
+// Ratings holds the skill ratings of all API keys and AIs.
+// It uses Elo adapted to free-for-all games: a game counts as a duel between each pair of players,
+// where the better placed player wins and players with the same place draw. The change of each duel is scaled by the number of opponents.
+// The ratings will regularily be saved to the disc.
+type Ratings struct {
+	Keys map[string]*Rating
+	AIs  map[string]*Rating
+
+	l        sync.Mutex
+	filename string
+	changed  bool
+}
+
+// GlobalRatings is the global instance of Ratings.
+var GlobalRatings Ratings
+
+// InitRatings initialises the global instance of Ratings. If the file does not exist, it will be created.
+// Not safe to be used in parallel with other rating functions.
+func InitRatings(filename string) {
+	GlobalRatings.filename = filename
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		GlobalRatings.Keys = make(map[string]*Rating)
+		GlobalRatings.AIs = make(map[string]*Rating)
+	} else {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			panic(err)
+		}
+		err = json.Unmarshal(b, &GlobalRatings)
+		if err != nil {
+			panic(err)
+		}
+		if GlobalRatings.Keys == nil {
+			GlobalRatings.Keys = make(map[string]*Rating)
+		}
+		if GlobalRatings.AIs == nil {
+			GlobalRatings.AIs = make(map[string]*Rating)
+		}
+		GlobalRatings.migrateKeys()
+	}
+	go GlobalRatings.worker()
+}
+
+// migrateKeys replaces plain API keys (used by older versions of the server) with their fingerprints (see KeyFingerprint),
+// so no keys are stored in the rating file. If a key already has a rating under its fingerprint, the newer rating is kept.
+// Not safe to be used in parallel with other rating functions.
+func (r *Ratings) migrateKeys() {
+	migrated := 0
+	for k, v := range r.Keys {
+		if IsKeyFingerprint(k) {
+			continue
+		}
+		f := KeyFingerprint(k)
+		if old, ok := r.Keys[f]; !ok || old.LastGame.Before(v.LastGame) {
+			r.Keys[f] = v
+		}
+		delete(r.Keys, k)
+		migrated++
+	}
+	if migrated != 0 {
+		r.changed = true
+		log.Println("rating:", "migrated", migrated, "keys to fingerprints")
+	}
+}
+
+// Update updates the ratings with the results of a game. Multiple results with the same name (e.g. the same AI twice) share one rating.
+// Has no effect if the ratings were not initialised.
+func (r *Ratings) Update(results []RatingResult) {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if r.Keys == nil || len(results) < 2 {
+		return
+	}
+
+	ratings := make([]*Rating, len(results))
+	old := make([]float64, len(results))
+	for i := range results {
+		m := r.Keys
+		if results[i].AI {
+			m = r.AIs
+		}
+		rating, ok := m[results[i].Name]
+		if !ok {
+			rating = &Rating{Rating: RatingInitial}
+			m[results[i].Name] = rating
+		}
+		ratings[i] = rating
+		old[i] = rating.Rating
+	}
+
+	k := RatingK / float64(len(results)-1)
+	for i := range results {
+		for j := range results {
+			if ratings[i] == ratings[j] {
+				continue
+			}
+			score := 0.5
+			switch {
+			case results[i].Place < results[j].Place:
+				score = 1
+			case results[i].Place > results[j].Place:
+				score = 0
+			}
+			expected := 1 / (1 + math.Pow(10, (old[j]-old[i])/400))
+			ratings[i].Rating += k * (score - expected)
+		}
+	}
+
+	now := time.Now()
+	for i := range ratings {
+		if !ratings[i].LastGame.Equal(now) {
+			ratings[i].Games++
+			ratings[i].LastGame = now
+		}
+	}
+	r.changed = true
+}
+
+// List returns all ratings ordered by rating (highest first).
+func (r *Ratings) List() []RatingEntry {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	list := make([]RatingEntry, 0, len(r.Keys)+len(r.AIs))
+	for k, v := range r.Keys {
+		list = append(list, RatingEntry{Name: k, AI: false, Rating: *v})
+	}
+	for k, v := range r.AIs {
+		list = append(list, RatingEntry{Name: k, AI: true, Rating: *v})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Rating.Rating == list[j].Rating.Rating {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].Rating.Rating > list[j].Rating.Rating
+	})
+	return list
+}
+
+func (r *Ratings) worker() {
+	for {
+		time.Sleep(RatingSaveInterval)
+		r.l.Lock()
+		if r.changed {
+			b, err := json.Marshal(r)
+			if err != nil {
+				log.Println("rating:", "marshal", err)
+			} else {
+				err = ioutil.WriteFile(r.filename, b, 0644)
+				if err != nil {
+					log.Println("rating:", "writing file", err)
+				} else {
+					r.changed = false
+					log.Println("rating:", "saved state")
+				}
+			}
+		}
+		r.l.Unlock()
+	}
+}
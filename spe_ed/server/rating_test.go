@@ -0,0 +1,169 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// useRatings replaces all ratings by empty ratings for a test and restores them afterwards.
+func useRatings(t *testing.T) {
+	t.Helper()
+	GlobalRatings.l.Lock()
+	defer GlobalRatings.l.Unlock()
+
+	keys, ais := GlobalRatings.Keys, GlobalRatings.AIs
+	GlobalRatings.Keys = make(map[string]*Rating)
+	GlobalRatings.AIs = make(map[string]*Rating)
+	t.Cleanup(func() {
+		GlobalRatings.l.Lock()
+		defer GlobalRatings.l.Unlock()
+		GlobalRatings.Keys, GlobalRatings.AIs = keys, ais
+	})
+}
+
+// runAIGame runs a complete training game on a small board between the given AIs.
+func runAIGame(t *testing.T, ais []string, practice bool) *Game {
+	t.Helper()
+	g := NewGame(42, len(ais), len(ais))
+	g.Rules = TrainingRules()
+	g.Rules.FieldMinSize = 10
+	g.Rules.FieldMaxSize = 15
+	g.Practice = practice
+	err := g.AddNamedAI(ais)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = g.RunGame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestRatingsUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []RatingResult
+		want    map[string]float64 // rating change of each name
+	}{
+		{
+			name:    "duel",
+			results: []RatingResult{{Name: "a", Place: 1}, {Name: "b", Place: 2}},
+			want:    map[string]float64{"a": RatingK / 2, "b": -RatingK / 2},
+		},
+		{
+			name:    "draw",
+			results: []RatingResult{{Name: "a", Place: 1}, {Name: "b", Place: 1}},
+			want:    map[string]float64{"a": 0, "b": 0},
+		},
+		{
+			name:    "three players",
+			results: []RatingResult{{Name: "a", Place: 1}, {Name: "b", Place: 2}, {Name: "c", Place: 3}},
+			want:    map[string]float64{"a": RatingK / 2, "b": 0, "c": -RatingK / 2},
+		},
+		{
+			name:    "key and ai with the same name",
+			results: []RatingResult{{Name: "a", Place: 1}, {Name: "a", AI: true, Place: 2}},
+			want:    map[string]float64{"a": RatingK / 2, "AI a": -RatingK / 2},
+		},
+		{
+			name:    "single player",
+			results: []RatingResult{{Name: "a", Place: 1}},
+			want:    map[string]float64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useRatings(t)
+			GlobalRatings.Update(tt.results)
+
+			got := make(map[string]float64)
+			for _, e := range GlobalRatings.List() {
+				name := e.Name
+				if e.AI {
+					name = "AI " + name
+				}
+				got[name] = e.Rating.Rating - RatingInitial
+				if e.Games != 1 {
+					t.Errorf("%s: got %d games, want 1", name, e.Games)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got ratings %v, want %v", got, tt.want)
+			}
+			for name, want := range tt.want {
+				if math.Abs(got[name]-want) > 1e-9 {
+					t.Errorf("%s: got change %f, want %f", name, got[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestRatingsAfterGame(t *testing.T) {
+	useRatings(t)
+	runAIGame(t, []string{"StupidAI", "SnailAI"}, false)
+
+	GlobalRatings.l.Lock()
+	defer GlobalRatings.l.Unlock()
+	if len(GlobalRatings.Keys) != 0 {
+		t.Errorf("AIs were rated as keys: %v", GlobalRatings.Keys)
+	}
+	for _, ai := range []string{"StupidAI", "SnailAI"} {
+		if r, ok := GlobalRatings.AIs[ai]; !ok || r.Games != 1 {
+			t.Errorf("%s: got rating %+v", ai, r)
+		}
+	}
+}
+
+func TestRatingsPractice(t *testing.T) {
+	useRatings(t)
+	runAIGame(t, []string{"StupidAI", "SnailAI"}, true)
+
+	if list := GlobalRatings.List(); len(list) != 0 {
+		t.Errorf("practice game was rated: %v", list)
+	}
+}
+
+func TestRatingsMigrateKeys(t *testing.T) {
+	now := time.Now()
+	r := Ratings{
+		Keys: map[string]*Rating{
+			"plain":                 {Rating: 1600, Games: 3, LastGame: now},
+			"old":                   {Rating: 1400, Games: 1, LastGame: now.Add(-time.Hour)},
+			KeyFingerprint("old"):   {Rating: 1550, Games: 5, LastGame: now},
+			KeyFingerprint("other"): {Rating: 1500, Games: 1, LastGame: now},
+		},
+		AIs: map[string]*Rating{"SnailAI": {Rating: 1700}},
+	}
+	r.migrateKeys()
+
+	want := map[string]float64{KeyFingerprint("plain"): 1600, KeyFingerprint("old"): 1550, KeyFingerprint("other"): 1500}
+	if len(r.Keys) != len(want) {
+		t.Errorf("got %d keys, want %d", len(r.Keys), len(want))
+	}
+	for k, rating := range want {
+		if r.Keys[k] == nil || r.Keys[k].Rating != rating {
+			t.Errorf("%s: got %+v, want rating %v", k, r.Keys[k], rating)
+		}
+	}
+	if r.AIs["SnailAI"] == nil || !r.changed {
+		t.Error("ais changed or migration not saved")
+	}
+}
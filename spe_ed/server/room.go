@@ -0,0 +1,220 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultRoom is the name of the room used if no room is given.
+const DefaultRoom = "default"
+
+// Room is a lobby in which players wait for their next game. Each room runs its games independently of all other rooms.
+// The exported fields are the configuration of the room and must not be changed after the room was added.
+type Room struct {
+	Name       string `json:"name"`
+	Wait       string `json:"wait"`       // Maximum waiting time for new games, must be parseable by time.Duration
+	MinPlayers int    `json:"minPlayers"` // Minimum number of players per game
+	MaxPlayers int    `json:"maxPlayers"` // Maximum number of players per game
+	FillAI     bool   `json:"fillAI"`     // Whether missing players are replaced by AIs after the waiting time
+	Seed       int64  `json:"seed"`       // Seed for all games, 0 means a random seed for each game
+	Rules      *Rules `json:"rules"`      // Rules of all games, nil means the default rules. Missing fields keep their default value
+
+	waitTime    time.Duration
+	l           sync.Mutex
+	current     *Game
+	newGameTime time.Time
+}
+
+var (
+	roomsLock sync.Mutex
+	rooms     = make(map[string]*Room)
+)
+
+// InitRooms initialises all rooms from a JSON file containing a list of rooms.
+// If filename is empty, only the default room is created from the command line options.
+// Not safe to be used in parallel with other room functions.
+func InitRooms(filename string) {
+	if filename == "" {
+		err := AddRoom(&Room{Name: DefaultRoom, Wait: maxWaitTime.String(), MinPlayers: 2, MaxPlayers: PlayersPerGame, FillAI: true, Seed: gameSeed})
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		panic(err)
+	}
+	var list []*Room
+	err = json.Unmarshal(b, &list)
+	if err != nil {
+		panic(err)
+	}
+	for i := range list {
+		err = AddRoom(list[i])
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// AddRoom validates a room and adds it. The name must be unique.
+func AddRoom(r *Room) error {
+	if r.Name == "" {
+		return fmt.Errorf("room must have a name")
+	}
+	var err error
+	r.waitTime, err = time.ParseDuration(r.Wait)
+	if err != nil {
+		return fmt.Errorf("room %s: %w", r.Name, err)
+	}
+	if r.waitTime < 0 {
+		return fmt.Errorf("room %s: waiting time too small", r.Name)
+	}
+	if r.MinPlayers < 2 || r.MaxPlayers < r.MinPlayers || r.MaxPlayers > MaxPlayersPerGame {
+		return fmt.Errorf("room %s: players must be 2 <= minPlayers <= maxPlayers <= %d", r.Name, MaxPlayersPerGame)
+	}
+	if r.FillAI && AIPoolSize() < r.MaxPlayers {
+		return fmt.Errorf("room %s: ai pool must contain at least %d ais", r.Name, r.MaxPlayers)
+	}
+	if r.Rules != nil {
+		if err := r.Rules.Validate(r.MaxPlayers); err != nil {
+			return fmt.Errorf("room %s: %w", r.Name, err)
+		}
+	} else if err := DefaultRules().ValidateGame(r.MaxPlayers); err != nil {
+		return fmt.Errorf("room %s: %w", r.Name, err)
+	}
+
+	roomsLock.Lock()
+	defer roomsLock.Unlock()
+	if _, ok := rooms[r.Name]; ok {
+		return fmt.Errorf("room %s already exists", r.Name)
+	}
+	rooms[r.Name] = r
+	return nil
+}
+
+// GetRoom returns the room with the given name or nil if it does not exist.
+// An empty name returns the default room.
+func GetRoom(name string) *Room {
+	if name == "" {
+		name = DefaultRoom
+	}
+	roomsLock.Lock()
+	defer roomsLock.Unlock()
+	return rooms[name]
+}
+
+// GetRooms returns all rooms ordered by name.
+func GetRooms() []*Room {
+	roomsLock.Lock()
+	defer roomsLock.Unlock()
+	list := make([]*Room, 0, len(rooms))
+	for k := range rooms {
+		list = append(list, rooms[k])
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// WaitTime returns the maximum waiting time of the room.
+func (r *Room) WaitTime() time.Duration {
+	return r.waitTime
+}
+
+// ContainsAPI returns whether a player with the given API key is waiting in the room.
+func (r *Room) ContainsAPI(api string) bool {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	return r.current != nil && r.current.ContainsAPI(api)
+}
+
+// Join adds a player to the next game of the room. The game is started as soon as it is full.
+// If the player can not be added, the connection of the player is closed.
+func (r *Room) Join(p *Player) {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if r.current == nil {
+		r.newGame()
+	}
+
+	err := r.current.AddPlayer(p)
+	if err == ErrFullTeam {
+		log.Println("room:", r.Name, "team full:", KeyFingerprint(p.api))
+		p.Close()
+		return
+	}
+	if err == ErrFullGame {
+		if r.current.IsReady() {
+			go r.current.RunGame()
+			r.newGame()
+			if err := r.current.AddPlayer(p); err != nil {
+				log.Println("room:", r.Name, "add player second time:", err)
+				p.Close()
+				return
+			}
+		} else {
+			log.Println("room:", r.Name, "full game, but not ready")
+			p.Close()
+			return
+		}
+	}
+
+	if r.current.IsReady() {
+		go r.current.RunGame()
+		r.current = nil
+	}
+}
+
+// check starts the waiting game if the waiting time is over.
+// Missing players are replaced by AIs if the room allows it, otherwise the game starts with the players present if there are enough.
+func (r *Room) check() {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if r.current == nil {
+		return
+	}
+
+	if time.Now().Sub(r.newGameTime) > r.waitTime {
+		if r.FillAI {
+			r.current.FillAI()
+		} else if !r.current.ReduceMaxPlayer() {
+			return
+		}
+		go r.current.RunGame()
+		r.current = nil
+	}
+}
+
+// newGame creates a new game for the room.
+// Caller has to lock the room.
+func (r *Room) newGame() {
+	r.current = NewGame(r.Seed, r.MinPlayers, r.MaxPlayers)
+	if r.Rules != nil {
+		r.current.Rules = *r.Rules
+	}
+	r.newGameTime = time.Now()
+}
@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// resetRooms removes all rooms for a test and restores them afterwards.
+func resetRooms(t *testing.T) {
+	t.Helper()
+	roomsLock.Lock()
+	old := rooms
+	rooms = make(map[string]*Room)
+	roomsLock.Unlock()
+	t.Cleanup(func() {
+		roomsLock.Lock()
+		rooms = old
+		roomsLock.Unlock()
+	})
+}
+
+// tempFile writes content to a file in a temporary directory and returns its path.
+func tempFile(t *testing.T, name, content string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "spe_ed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, name)
+	err = ioutil.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAddRoom(t *testing.T) {
+	tests := []struct {
+		name string
+		room *Room
+		err  string // empty if the room is valid
+	}{
+		{"valid", &Room{Name: "valid", Wait: "1m", MinPlayers: 2, MaxPlayers: 4, FillAI: true}, ""},
+		{"duplicate", &Room{Name: "valid", Wait: "1m", MinPlayers: 2, MaxPlayers: 4}, "already exists"},
+		{"no name", &Room{Wait: "1m", MinPlayers: 2, MaxPlayers: 4}, "must have a name"},
+		{"invalid wait", &Room{Name: "wait", Wait: "soon", MinPlayers: 2, MaxPlayers: 4}, "invalid duration"},
+		{"negative wait", &Room{Name: "wait", Wait: "-1s", MinPlayers: 2, MaxPlayers: 4}, "waiting time too small"},
+		{"single player", &Room{Name: "players", Wait: "1m", MinPlayers: 1, MaxPlayers: 4}, "players must be"},
+		{"min above max", &Room{Name: "players", Wait: "1m", MinPlayers: 4, MaxPlayers: 3}, "players must be"},
+		{"too many players", &Room{Name: "players", Wait: "1m", MinPlayers: 2, MaxPlayers: MaxPlayersPerGame + 1}, "players must be"},
+		{"ai pool too small", &Room{Name: "ai", Wait: "1m", MinPlayers: 2, MaxPlayers: AIPoolSize() + 1, FillAI: true}, "ai pool"},
+		{"invalid rules", &Room{Name: "rules", Wait: "1m", MinPlayers: 2, MaxPlayers: 4, Rules: &Rules{}}, "invalid rules"},
+	}
+	resetRooms(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.room
+			err := AddRoom(r)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if GetRoom(r.Name) != r {
+					t.Error("room was not added")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestInitRooms(t *testing.T) {
+	resetRooms(t)
+	InitRooms(tempFile(t, "rooms", `[
+	{"name": "default", "wait": "5m", "minPlayers": 2, "maxPlayers": 6, "fillAI": true},
+	{"name": "fast", "wait": "5s", "minPlayers": 2, "maxPlayers": 2, "fillAI": false, "seed": 42, "rules": {"maxSpeed": 5}}
+]`))
+
+	list := GetRooms()
+	if len(list) != 2 || list[0].Name != "default" || list[1].Name != "fast" {
+		t.Fatalf("got rooms %v", list)
+	}
+	if GetRoom("") != list[0] || GetRoom("missing") != nil {
+		t.Error("GetRoom does not return the expected rooms")
+	}
+
+	fast := GetRoom("fast")
+	if fast.WaitTime() != 5*time.Second || fast.Seed != 42 || fast.FillAI {
+		t.Errorf("got room %+v", fast)
+	}
+	if fast.Rules == nil || fast.Rules.MaxSpeed != 5 || fast.Rules.HolesEachStep != HolesEachStep || fast.Rules.FieldMinSize != FieldMinSize {
+		t.Errorf("missing rules do not keep the default value: %+v", fast.Rules)
+	}
+	if list[0].Rules != nil {
+		t.Errorf("got rules %+v for room without rules", list[0].Rules)
+	}
+}
+
+func TestRoomJoin(t *testing.T) {
+	r := &Room{Name: "join", Wait: "1h", MinPlayers: 3, MaxPlayers: 3}
+	resetRooms(t)
+	err := AddRoom(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Join(&Player{api: "first"})
+	r.Join(&Player{api: "second"})
+	if !r.ContainsAPI("first") || !r.ContainsAPI("second") || r.ContainsAPI("third") {
+		t.Error("players are not waiting in the room")
+	}
+
+	// Not enough time has passed
+	r.check()
+	if r.current == nil {
+		t.Fatal("game started before the waiting time")
+	}
+
+	// Without AIs the game needs at least MinPlayers players
+	r.newGameTime = time.Now().Add(-2 * time.Hour)
+	r.check()
+	if r.current == nil {
+		t.Fatal("game started without enough players")
+	}
+}
+
+func TestRoomJoinFullTeam(t *testing.T) {
+	rules := DefaultRules()
+	rules.TeamSize = 2
+	r := &Room{Name: "teams", Wait: "1h", MinPlayers: 4, MaxPlayers: 4, Rules: &rules}
+	resetRooms(t)
+	err := AddRoom(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Join(&Player{api: "a1", teamName: "a"})
+	r.Join(&Player{api: "a2", teamName: "a"})
+	r.Join(&Player{api: "a3", teamName: "a"})
+	r.Join(&Player{api: "b1", teamName: "b"})
+	if !r.ContainsAPI("a1") || !r.ContainsAPI("a2") || !r.ContainsAPI("b1") {
+		t.Error("players are not waiting in the room")
+	}
+	if r.ContainsAPI("a3") {
+		t.Error("player of a full team was added")
+	}
+}
@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// deadlineFormatTraining is the format of the deadline in training games. It is compatible to RFC3339, but contains milliseconds.
+const deadlineFormatTraining = "2006-01-02T15:04:05.000Z07:00"
+
+// Rules holds the rule set of a single game. It is sent to the clients as part of each state.
+type Rules struct {
+	FieldMinSize      int    `json:"fieldMinSize"`      // Minimum size of the field (both width and height), the actual size is larger
+	FieldMaxSize      int    `json:"fieldMaxSize"`      // Maximum size of the field (both width and height)
+	MaxSpeed          int    `json:"maxSpeed"`          // Maximum speed of a player
+	HolesEachStep     int    `json:"holesEachStep"`     // Number of steps after which a hole might occur
+	HoleSpeed         int    `json:"holeSpeed"`         // Minimum speed needed for a hole
+	RoundTimeoutMin   int    `json:"roundTimeoutMin"`   // Minimum time of a round (in seconds, in milliseconds for training games)
+	RoundTimeoutMax   int    `json:"roundTimeoutMax"`   // Maximum time of a round (in seconds, in milliseconds for training games)
+	RoundTimeoutGrace int    `json:"roundTimeoutGrace"` // Time after the deadline in which answers are still accepted (in seconds, in milliseconds for training games)
+	Torus             bool   `json:"torus"`             // Whether players leaving the board enter it on the opposite side instead of being eliminated
+	Map               string `json:"map"`               // Name of the map (see InitMaps), MapRandom for a random map or empty for an empty board of random size
+	ObstacleDensity   int    `json:"obstacleDensity"`   // Percentage of cells covered by randomly generated obstacles
+	// Sudden death starts after SuddenDeathRound rounds (0 disables it). Each SuddenDeathInterval rounds, free cells are filled according to SuddenDeathMode (see SuddenDeath).
+	SuddenDeathRound    int    `json:"suddenDeathRound"`
+	SuddenDeathMode     string `json:"suddenDeathMode"`
+	SuddenDeathInterval int    `json:"suddenDeathInterval"`
+	TeamSize            int    `json:"teamSize"` // Number of players per team, 0 or 1 means that every player plays alone
+	Training            bool   `json:"training"` // Whether round timeouts are given in milliseconds, the deadline contains milliseconds in this case
+}
+
+// DefaultRules returns the rules given by the configuration (e.g. FieldMinSize, MaxSpeed).
+func DefaultRules() Rules {
+	return Rules{
+		FieldMinSize:        FieldMinSize,
+		FieldMaxSize:        FieldMaxSize,
+		MaxSpeed:            MaxSpeed,
+		HolesEachStep:       HolesEachStep,
+		HoleSpeed:           HoleSpeed,
+		RoundTimeoutMin:     RoundTimeoutMin,
+		RoundTimeoutMax:     RoundTimeoutMax,
+		RoundTimeoutGrace:   RoundTimeoutGrace,
+		Torus:               Torus,
+		Map:                 MapName,
+		ObstacleDensity:     ObstacleDensity,
+		SuddenDeathRound:    SuddenDeathRound,
+		SuddenDeathMode:     SuddenDeathMode,
+		SuddenDeathInterval: SuddenDeathInterval,
+		TeamSize:            TeamSize,
+	}
+}
+
+// TrainingRules returns the default rules (see DefaultRules) with the round timeouts of training games (e.g. TrainingTimeoutMin).
+func TrainingRules() Rules {
+	r := DefaultRules()
+	r.Training = true
+	r.RoundTimeoutMin = TrainingTimeoutMin
+	r.RoundTimeoutMax = TrainingTimeoutMax
+	r.RoundTimeoutGrace = TrainingTimeoutGrace
+	return r
+}
+
+// TimeoutUnit returns the unit of the round timeouts.
+func (r Rules) TimeoutUnit() time.Duration {
+	if r.Training {
+		return time.Millisecond
+	}
+	return time.Second
+}
+
+// DeadlineFormat returns the format of the deadline sent to the players.
+func (r Rules) DeadlineFormat() string {
+	if r.Training {
+		return deadlineFormatTraining
+	}
+	return time.RFC3339
+}
+
+// UnmarshalJSON decodes rules. Fields missing in b keep their default value (see DefaultRules).
+func (r *Rules) UnmarshalJSON(b []byte) error {
+	type plainRules Rules // Prevents recursion
+	p := plainRules(DefaultRules())
+	err := json.Unmarshal(b, &p)
+	if err != nil {
+		return err
+	}
+	*r = Rules(p)
+	return nil
+}
+
+// ValidateGame checks whether a game with the given number of players can be played with the rules.
+// Unlike Validate, a map which is too small and a team size which is too large are allowed, since the game falls back to an empty board and smaller teams.
+func (r Rules) ValidateGame(players int) error {
+	r.Map = ""
+	if 2*r.TeamSize > players {
+		r.TeamSize = players / 2
+	}
+	return r.Validate(players)
+}
+
+// Validate checks whether games with up to maxPlayers players can be played with the rules.
+// All errors are collected and returned together.
+func (r Rules) Validate(maxPlayers int) error {
+	var errs []string
+
+	areasX, areasY := spawnAreas(maxPlayers)
+	if r.FieldMinSize+1 < areasX || r.FieldMinSize+1 < areasY {
+		errs = append(errs, fmt.Sprintf("minimum field size must be at least %d", areasX-1))
+	}
+	if r.FieldMaxSize <= r.FieldMinSize {
+		errs = append(errs, "maximum field size must be larger than minimum field size")
+	}
+	if r.MaxSpeed < 1 {
+		errs = append(errs, "maximum speed must be at least 1")
+	}
+	if r.HolesEachStep < 1 {
+		errs = append(errs, "holes each step must be at least 1")
+	}
+	if r.HoleSpeed < 1 {
+		errs = append(errs, "hole speed must be at least 1")
+	}
+	if r.RoundTimeoutMin < 1 {
+		errs = append(errs, "minimum round timeout must be at least 1")
+	}
+	if r.RoundTimeoutMax < r.RoundTimeoutMin {
+		errs = append(errs, "maximum round timeout must not be smaller than minimum round timeout")
+	}
+	if r.RoundTimeoutGrace < 0 {
+		errs = append(errs, "round timeout grace must be at least 0")
+	}
+	if err := validateMap(r.Map, maxPlayers); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if r.ObstacleDensity < 0 || r.ObstacleDensity > MaxObstacleDensity {
+		errs = append(errs, fmt.Sprintf("obstacle density must be between 0 and %d", MaxObstacleDensity))
+	}
+	if r.SuddenDeathRound < 0 {
+		errs = append(errs, "sudden death round must be at least 0")
+	}
+	if r.SuddenDeathMode != SuddenDeathRing && r.SuddenDeathMode != SuddenDeathBlocks {
+		errs = append(errs, fmt.Sprintf("sudden death mode must be %s or %s", SuddenDeathRing, SuddenDeathBlocks))
+	}
+	if r.SuddenDeathInterval < 1 {
+		errs = append(errs, "sudden death interval must be at least 1")
+	}
+	if r.TeamSize < 0 || 2*r.TeamSize > maxPlayers {
+		errs = append(errs, fmt.Sprintf("team size must be between 0 and %d", maxPlayers/2))
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("invalid rules: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,339 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	golog "log"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// SimulationResult is the result of a single simulated game.
+type SimulationResult struct {
+	AIs     map[int]string // name of the AI of each player
+	Ranking []Placement    // in team games, each player gets the place of its team
+	Winners []int          // the winning player or all players of the winning team, empty for a draw
+	Rounds  map[int]int    // last round played by each player
+	Length  int            // number of rounds of the game
+	Err     error
+}
+
+// NewSimulatedGame returns a new game between AIs with the given names (as registered with RegisterAI) which can be run by Simulate.
+// If seed is 0, a random seed is chosen.
+func NewSimulatedGame(seed int64, ais []string, rules Rules) (*Game, error) {
+	if len(ais) < 2 || len(ais) > MaxPlayersPerGame {
+		return nil, fmt.Errorf("number of ais must be between 2 and %d", MaxPlayersPerGame)
+	}
+	g := NewGame(seed, len(ais), len(ais))
+	g.Rules = rules
+	g.Practice = true
+
+	g.l.Lock()
+	defer g.l.Unlock()
+	g.setMaxPlayer()
+
+	aiLock.RLock()
+	defer aiLock.RUnlock()
+	counter := make(map[string]int, len(ais))
+	newAIs := make([]NewAI, len(ais))
+	for i := range ais {
+		f, ok := aiMap[ais[i]]
+		if !ok {
+			return nil, fmt.Errorf("ai name %s not known", ais[i])
+		}
+		counter[ais[i]]++
+		newAIs[i].AI = f()
+		newAIs[i].API = fmt.Sprintf("AI-%s-%d", ais[i], counter[ais[i]])
+		newAIs[i].AI.SetSeed(g.rng.Int63())
+	}
+	g.addAI(newAIs)
+	return g, nil
+}
+
+// Simulate runs the game like RunGame, but without websockets and deadlines. All players must be AIs.
+// The AIs are asked for their actions one after another, an AI not answering in GetState is treated like a player missing the deadline.
+// It will return the final ranking of all players (see Ranking). If errors occur, this value is undefined.
+func (g *Game) Simulate() ([]Placement, error) {
+	g.l.Lock()
+	defer g.l.Unlock()
+
+	g.setMaxPlayer()
+
+	if g.numberPlayer != g.MaxPlayer {
+		return nil, errors.New("not enough player")
+	}
+	for i := range g.Players {
+		if g.Players[i].underlyingAI == nil {
+			return nil, errors.New("only ais can be simulated")
+		}
+	}
+
+	var err error
+	g.log, _, err = GetLogger()
+	if err == nil && g.log != nil {
+		defer g.log.Close()
+	}
+
+	g.initialise()
+	if g.log != nil {
+		g.log.LogStart(g)
+	}
+
+	for {
+		// The deadline is not used, but drawn anyway so that all random decisions are identical to RunGame
+		g.rng.Intn(g.Rules.RoundTimeoutMax - g.Rules.RoundTimeoutMin + 1)
+		latency := g.simulateState()
+		g.log.StartRound(g)
+
+		actions := make(map[int]string, len(g.Players))
+		for _, i := range playerIDs(g) {
+			c := g.playerChannel[i-1]
+			if c == nil {
+				continue
+			}
+			select {
+			case a := <-c:
+				g.log.LogAction(i, a, latency[i])
+				switch {
+				case len(c) != 0:
+					g.invalidatePlayer(i, Elimination{Reason: EliminationDuplicateAnswer, Round: g.round})
+					for len(c) != 0 {
+						<-c
+					}
+				case a == "" || !IsValidAction(a):
+					g.invalidatePlayer(i, Elimination{Reason: EliminationInvalidAnswer, Round: g.round})
+				default:
+					actions[i] = a
+				}
+			default:
+				// No answer - Step eliminates the player
+			}
+		}
+
+		g.computeRound(actions)
+		g.log.EndRound(g)
+
+		if g.checkEndGame() {
+			break
+		}
+	}
+
+	g.finish()
+	g.simulateState()
+	return g.Ranking, nil
+}
+
+// simulateState passes the current state to all AIs and waits until they have computed their answer.
+// It returns the time each AI needed.
+// Caller has to lock the game.
+func (g *Game) simulateState() map[int]time.Duration {
+	if g.log != nil {
+		g.log.LogState(g)
+	}
+
+	latency := make(map[int]time.Duration, len(g.Players))
+	for _, i := range playerIDs(g) {
+		c := g.PublicCopy()
+		c.You = i
+		start := time.Now()
+		g.Players[i].underlyingAI.GetState(c)
+		latency[i] = time.Since(start)
+	}
+	return latency
+}
+
+// RunSimulation simulates a number of games between the given AIs using parallel workers.
+// The seed of each game is derived from seed, if seed is 0 a random seed is chosen. The results are ordered like the games.
+func RunSimulation(games, parallel int, seed int64, ais []string, rules Rules) []SimulationResult {
+	if seed == 0 {
+		seed = rand.Int63()
+	}
+	r := rand.New(rand.NewSource(seed))
+	seeds := make([]int64, games)
+	for i := range seeds {
+		seeds[i] = r.Int63()
+	}
+
+	results := make([]SimulationResult, games)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = simulateGame(seeds[i], ais, rules)
+			}
+		}()
+	}
+	for i := range results {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// simulateGame simulates a single game and collects its result.
+func simulateGame(seed int64, ais []string, rules Rules) SimulationResult {
+	g, err := NewSimulatedGame(seed, ais, rules)
+	if err != nil {
+		return SimulationResult{Err: err}
+	}
+	ranking, err := g.Simulate()
+	if err != nil {
+		return SimulationResult{Err: err}
+	}
+
+	result := SimulationResult{
+		AIs:     make(map[int]string, len(g.Players)),
+		Ranking: g.PlayerPlaces(),
+		Winners: make([]int, 0, 1),
+		Rounds:  make(map[int]int, len(g.Players)),
+		Length:  g.round - 1,
+	}
+	if g.TeamRanking != nil {
+		if team := Winner(g.TeamRanking); team != -1 {
+			for _, i := range playerIDs(g) {
+				if g.Players[i].Team == team {
+					result.Winners = append(result.Winners, i)
+				}
+			}
+		}
+	} else if winner := Winner(ranking); winner != -1 {
+		result.Winners = append(result.Winners, winner)
+	}
+	for i, p := range g.Players {
+		result.AIs[i] = p.underlyingAI.Name()
+		result.Rounds[i] = result.Length
+		if p.Elimination != nil {
+			result.Rounds[i] = p.Elimination.Round
+		}
+	}
+	return result
+}
+
+// simulateCommand implements the "simulate" command line: it simulates games between AIs and prints statistics for each AI.
+func simulateCommand(args []string) {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	games := fs.Int("games", 100, "Number of games to simulate")
+	ais := fs.String("ais", "", "Comma separated list of ais playing in each game (see -listais of the server). An ai can be given multiple times")
+	parallel := fs.Int("parallel", runtime.NumCPU(), "Number of games simulated in parallel")
+	seed := fs.Int64("seed", 0, "Seed used to derive the seeds of all games. 0 means a random seed")
+	rulesFile := fs.String("rules", "", "Path to a JSON file containing the rules (like the rules of a room). If not set, the default rules are used")
+	mapdir := fs.String("mapdir", "", "Path to a directory containing maps, see -mapdir of the server")
+	writeLog := fs.Bool("log", false, "Writes a log of each game like the server")
+	fs.Parse(args)
+
+	log = golog.New(os.Stderr, "spe_ed simulate ", golog.LstdFlags)
+	disableLogging = !*writeLog
+
+	if *mapdir != "" {
+		InitMaps(*mapdir)
+	}
+
+	names := splitList(*ais)
+	rules := DefaultRules()
+	if *rulesFile != "" {
+		b, err := ioutil.ReadFile(*rulesFile)
+		if err != nil {
+			panic(err)
+		}
+		err = json.Unmarshal(b, &rules)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if err := rules.Validate(len(names)); err != nil {
+		panic(err)
+	}
+	if *games < 1 || *parallel < 1 {
+		panic("games and parallel must be at least 1")
+	}
+
+	results := RunSimulation(*games, *parallel, *seed, names, rules)
+
+	type aiStats struct {
+		games, wins, places, rounds int
+	}
+	stats := make(map[string]*aiStats)
+	length, draws, failed := 0, 0, 0
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Fprintln(os.Stderr, "simulate:", r.Err)
+			failed++
+			continue
+		}
+		length += r.Length
+		if len(r.Winners) == 0 {
+			draws++
+		}
+		winners := make(map[int]bool, len(r.Winners))
+		for _, p := range r.Winners {
+			winners[p] = true
+		}
+		for _, p := range r.Ranking {
+			s, ok := stats[r.AIs[p.Player]]
+			if !ok {
+				s = new(aiStats)
+				stats[r.AIs[p.Player]] = s
+			}
+			s.games++
+			s.places += p.Place
+			s.rounds += r.Rounds[p.Player]
+			if winners[p.Player] {
+				s.wins++
+			}
+		}
+	}
+
+	played := len(results) - failed
+	if played == 0 {
+		fmt.Println("no games simulated")
+		return
+	}
+
+	list := make([]string, 0, len(stats))
+	for k := range stats {
+		list = append(list, k)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := stats[list[i]], stats[list[j]]
+		if a.wins*b.games != b.wins*a.games {
+			return a.wins*b.games > b.wins*a.games
+		}
+		return list[i] < list[j]
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "AI\tGames\tWins\tWin rate\tAvg. placement\tAvg. rounds survived")
+	for _, name := range list {
+		s := stats[name]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f%%\t%.2f\t%.1f\n", name, s.games, s.wins, 100*float64(s.wins)/float64(s.games), float64(s.places)/float64(s.games), float64(s.rounds)/float64(s.games))
+	}
+	w.Flush()
+	fmt.Printf("\nGames: %d, draws: %d, failed: %d, avg. game length: %.1f rounds\n", played, draws, failed, float64(length)/float64(played))
+}
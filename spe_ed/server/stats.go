@@ -26,16 +26,25 @@ import (
 
 // PlayerStats contains the statistics of a single player.
 type PlayerStats struct {
-	Key       string
-	Pseudonym string
-	Bot       bool
+	Key         string
+	Pseudonym   string
+	Bot         bool
+	Team        int // 0 if the game is not played in teams
+	Elimination *Elimination
+}
+
+// LobbyStats contains a key waiting in a room.
+type LobbyStats struct {
+	Key  string
+	Room string
 }
 
 // GameStats contains the statistics of a game.
 type GameStats struct {
-	Key     string
-	Start   time.Time
-	Players map[int]PlayerStats
+	Key      string
+	Start    time.Time
+	Practice bool
+	Players  map[int]PlayerStats
 }
 
 // SendStat is used to add new Games to the statistics.
@@ -48,7 +57,7 @@ var DeleteStat chan<- string
 
 // SendLobby is used to add new keys to the lobby statistics.
 // Will block before InitStats is called.
-var SendLobby chan<- string
+var SendLobby chan<- LobbyStats
 
 // DeleteLobby is used to remove keys from the lobby statistics.
 // Will block before InitStats is called.
@@ -64,13 +73,14 @@ var statsTemplate *template.Template
 type statsTemplateStruct struct {
 	Time       time.Time
 	GameStats  map[string]GameStats
-	LobbyStats map[string]bool
-	LobbyTime  time.Duration
+	LobbyStats map[string]string
+	Rooms      []*Room
+	Ratings    []RatingEntry
 }
 
 var statsOnce sync.Once
 var statsMap map[string]GameStats
-var lobbyMap map[string]bool
+var lobbyMap map[string]string
 
 // InitStats will initialise the statistics routines. Successive calls have no effect.
 func InitStats() {
@@ -80,20 +90,61 @@ func InitStats() {
 		<html lang="en">
 		<body>
 			<p>Time: {{ .Time.UTC.Format "2006-01-02T15:04:05Z07:00" }}</p>
-			<p>Lobby max. wait time: {{.LobbyTime}}
+			<h1>Rooms</h1>
+			<table>
+				<tr>
+					<th>Name</th>
+					<th>Max. wait time</th>
+					<th>Players</th>
+					<th>AI</th>
+					<th>Rules</th>
+				</tr>
+				{{ range $room := .Rooms }}
+				<tr>
+					<td>{{ $room.Name }}</td>
+					<td>{{ $room.WaitTime }}</td>
+					<td>{{ $room.MinPlayers }} - {{ $room.MaxPlayers }}</td>
+					<td>{{ $room.FillAI }}</td>
+					<td>{{ if $room.Rules }}custom{{ else }}default{{ end }}</td>
+				</tr>
+				{{ end }}
+			</table>
 			<h1>Lobby</h1>
 			{{ if .LobbyStats }}
 			<ul>
-			{{ range $key, $value := .LobbyStats }}
-				<li>{{ $key }}</li>
+			{{ range $key, $room := .LobbyStats }}
+				<li>{{ $key }} ({{ $room }})</li>
 			{{ end }}
 			</ul>
 			{{ else }}
 			<p>Empty</p>
 			{{ end }}
+			<h1>Ratings</h1>
+			{{ if .Ratings }}
+			<table>
+				<tr>
+					<th>Key</th>
+					<th>Bot</th>
+					<th>Rating</th>
+					<th>Games</th>
+					<th>Last game</th>
+				</tr>
+				{{ range $rating := .Ratings }}
+				<tr>
+					<td>{{ $rating.Name }}</td>
+					<td>{{ $rating.AI }}</td>
+					<td>{{ printf "%.0f" $rating.Rating.Rating }}</td>
+					<td>{{ $rating.Games }}</td>
+					<td>{{ $rating.LastGame.UTC.Format "2006-01-02T15:04:05Z07:00" }}</td>
+				</tr>
+				{{ end }}
+			</table>
+			{{ else }}
+			<p>Empty</p>
+			{{ end }}
 			<h1>Games</h1>
 			{{ range $gameID, $game := .GameStats }}
-				<h2>{{ $gameID }}</h2>
+				<h2>{{ $gameID }}{{ if $game.Practice }} (practice){{ end }}</h2>
 				<p>Start: {{$game.Start.UTC.Format "2006-01-02T15:04:05Z07:00"}}</p>
 				<h3>Players</h3>
 				<table>
@@ -102,6 +153,8 @@ func InitStats() {
 						<th>Key</th>
 						<th>Pseudonym</th>
 						<th>Bot</th>
+						<th>Team</th>
+						<th>Eliminated</th>
 					<tr>
 					{{ range $playerID, $player := $game.Players }}				
 					<tr>
@@ -109,6 +162,8 @@ func InitStats() {
 						<td>{{ $player.Key }}</td>
 						<td>{{ $player.Pseudonym }}</td>
 						<td>{{ $player.Bot }}</td>
+						<td>{{ if $player.Team }}{{ $player.Team }}{{ else }}-{{ end }}</td>
+						<td>{{ with $player.Elimination }}{{ .Reason }} (round {{ .Round }}{{ if .Opponent }}, by {{ .Opponent }}{{ end }}){{ else }}-{{ end }}</td>
 					</tr>
 					{{ end }}
 				</table>
@@ -120,10 +175,10 @@ func InitStats() {
 		s := make(chan GameStats)
 		d := make(chan string)
 		g := make(chan chan io.Reader, 10)
-		sl := make(chan string)
+		sl := make(chan LobbyStats)
 		dl := make(chan string)
 		statsMap = make(map[string]GameStats)
-		lobbyMap = make(map[string]bool)
+		lobbyMap = make(map[string]string)
 		SendStat = s
 		DeleteStat = d
 		GetStatPage = g
@@ -133,20 +188,20 @@ func InitStats() {
 	})
 }
 
-func workerStats(send <-chan GameStats, deleteStats <-chan string, sendLobby <-chan string, deleteLobby <-chan string, get <-chan chan io.Reader) {
+func workerStats(send <-chan GameStats, deleteStats <-chan string, sendLobby <-chan LobbyStats, deleteLobby <-chan string, get <-chan chan io.Reader) {
 	for {
 		select {
 		case gs := <-send:
 			statsMap[gs.Key] = gs
 		case k := <-deleteStats:
 			delete(statsMap, k)
-		case k := <-sendLobby:
-			lobbyMap[k] = true
+		case ls := <-sendLobby:
+			lobbyMap[ls.Key] = ls.Room
 		case k := <-deleteLobby:
 			delete(lobbyMap, k)
 		case g := <-get:
 			var buf bytes.Buffer
-			err := statsTemplate.Execute(&buf, statsTemplateStruct{Time: time.Now(), GameStats: statsMap, LobbyStats: lobbyMap, LobbyTime: maxWaitTime})
+			err := statsTemplate.Execute(&buf, statsTemplateStruct{Time: time.Now(), GameStats: statsMap, LobbyStats: lobbyMap, Rooms: GetRooms(), Ratings: GlobalRatings.List()})
 			if err != nil {
 				fmt.Println("error rendering stats:", err)
 			}
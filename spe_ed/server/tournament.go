@@ -0,0 +1,636 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// TournamentRoundRobin lets every combination of GroupSize keys play one game.
+	TournamentRoundRobin = "roundrobin"
+	// TournamentSwiss plays a fixed number of rounds, in each round players with similar points play against each other.
+	TournamentSwiss = "swiss"
+	// TournamentElimination plays until one key is left, only the winner of each game advances.
+	TournamentElimination = "elimination"
+
+	// TournamentMaxGames is the maximum number of games of a round robin tournament.
+	TournamentMaxGames = 10000
+)
+
+const (
+	tournamentGameWaiting  = "waiting"
+	tournamentGameRunning  = "running"
+	tournamentGameFinished = "finished"
+)
+
+// ErrNotScheduled is returned if a key joins a tournament without having a waiting game in the current round.
+var ErrNotScheduled = errors.New("no game scheduled")
+
+// TournamentDefinition describes a tournament as read from the tournament definition file.
+type TournamentDefinition struct {
+	Name      string   `json:"name"`
+	Format    string   `json:"format"`    // TournamentRoundRobin, TournamentSwiss or TournamentElimination
+	Keys      []string `json:"keys"`      // Fingerprints of the API keys taking part (see KeyFingerprint)
+	GroupSize int      `json:"groupSize"` // Number of players per game
+	Rounds    int      `json:"rounds"`    // Number of rounds, only used by TournamentSwiss
+	Wait      string   `json:"wait"`      // Time scheduled players have to connect, must be parseable by time.Duration
+	Seed      int64    `json:"seed"`      // Seed for scheduling and all games, 0 means a random seed
+}
+
+// TournamentStanding holds the accumulated results of a key in a tournament.
+// Each game counts as a duel between each pair of players: a better place gives 1 point, the same place 0.5 points.
+// A bye counts as winning against GroupSize-1 players, but not as game.
+type TournamentStanding struct {
+	Name             string  `json:"name"` // pseudonym of the key
+	Points           float64 `json:"points"`
+	Games            int     `json:"games"`
+	Wins             int     `json:"wins"`
+	AveragePlacement float64 `json:"averagePlacement"`
+	Eliminated       int     `json:"eliminated,omitempty"` // round of elimination, only used by TournamentElimination
+
+	placements int // sum of all places
+}
+
+// TournamentGame is a single scheduled game of a tournament.
+type TournamentGame struct {
+	Round   int      `json:"round"`
+	Players []string `json:"players"` // pseudonyms of the keys
+	State   string   `json:"state"`
+	Places  []int    `json:"places,omitempty"` // places in the same order as Players, absent players share the last place
+
+	keys    []string // fingerprints
+	waiting map[string]*Player
+}
+
+// Tournament runs the games of a tournament definition and keeps its standings.
+type Tournament struct {
+	def      TournamentDefinition
+	waitTime time.Duration
+	rng      *rand.Rand
+
+	l          sync.Mutex
+	round      int
+	roundStart time.Time
+	games      []*TournamentGame
+	standings  map[string]*TournamentStanding
+	schedule   [][][]string // only TournamentRoundRobin
+	remaining  []string     // only TournamentElimination
+	finished   bool
+}
+
+var tournament *Tournament
+
+var tournamentTemplate = template.Must(template.New("tournament").Funcs(template.FuncMap{"inc": func(i int) int { return i + 1 }}).Parse(`
+<!DOCTYPE HTML>
+<html lang="en">
+<body>
+	<h1>{{ .Name }}</h1>
+	<p>Format: {{ .Format }}</p>
+	<p>Round: {{ .Round }}{{ if .Finished }} (finished){{ end }}</p>
+	<h2>Standings</h2>
+	<table>
+		<tr>
+			<th>#</th>
+			<th>Name</th>
+			<th>Points</th>
+			<th>Games</th>
+			<th>Wins</th>
+			<th>Avg. placement</th>
+			<th>Eliminated</th>
+		</tr>
+		{{ range $i, $s := .Standings }}
+		<tr>
+			<td>{{ inc $i }}</td>
+			<td>{{ $s.Name }}</td>
+			<td>{{ $s.Points }}</td>
+			<td>{{ $s.Games }}</td>
+			<td>{{ $s.Wins }}</td>
+			<td>{{ printf "%.2f" $s.AveragePlacement }}</td>
+			<td>{{ if $s.Eliminated }}round {{ $s.Eliminated }}{{ else }}-{{ end }}</td>
+		</tr>
+		{{ end }}
+	</table>
+	<h2>Games</h2>
+	<table>
+		<tr>
+			<th>Round</th>
+			<th>State</th>
+			<th>Players</th>
+		</tr>
+		{{ range $g := .Games }}
+		<tr>
+			<td>{{ $g.Round }}</td>
+			<td>{{ $g.State }}</td>
+			<td>{{ range $i, $p := $g.Players }}{{ if $i }}, {{ end }}{{ $p }}{{ if $g.Places }} ({{ index $g.Places $i }}){{ end }}{{ end }}</td>
+		</tr>
+		{{ end }}
+	</table>
+</body>
+</html>
+`))
+
+// tournamentStatus is the public state of a tournament as shown on the standings page.
+type tournamentStatus struct {
+	Name      string               `json:"name"`
+	Format    string               `json:"format"`
+	Round     int                  `json:"round"`
+	Finished  bool                 `json:"finished"`
+	Standings []TournamentStanding `json:"standings"`
+	Games     []TournamentGame     `json:"games"`
+}
+
+// InitTournament reads a tournament definition (JSON) from a file and starts the tournament.
+func InitTournament(filename string) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		panic(err)
+	}
+	var def TournamentDefinition
+	err = json.Unmarshal(b, &def)
+	if err != nil {
+		panic(err)
+	}
+	t, err := NewTournament(def)
+	if err != nil {
+		panic(err)
+	}
+	tournament = t
+	go t.worker()
+}
+
+// NewTournament validates a tournament definition and returns a new tournament.
+func NewTournament(def TournamentDefinition) (*Tournament, error) {
+	t := &Tournament{def: def, standings: make(map[string]*TournamentStanding, len(def.Keys))}
+
+	var err error
+	t.waitTime, err = time.ParseDuration(def.Wait)
+	if err != nil {
+		return nil, fmt.Errorf("tournament %s: %w", def.Name, err)
+	}
+	if t.waitTime < 0 {
+		return nil, fmt.Errorf("tournament %s: waiting time too small", def.Name)
+	}
+	if def.GroupSize < 2 || def.GroupSize > MaxPlayersPerGame {
+		return nil, fmt.Errorf("tournament %s: group size must be between 2 and %d", def.Name, MaxPlayersPerGame)
+	}
+	if err := DefaultRules().ValidateGame(def.GroupSize); err != nil {
+		return nil, fmt.Errorf("tournament %s: %w", def.Name, err)
+	}
+	if len(def.Keys) < 2 {
+		return nil, fmt.Errorf("tournament %s: at least 2 keys needed", def.Name)
+	}
+	for _, k := range def.Keys {
+		if !IsKeyFingerprint(k) {
+			return nil, fmt.Errorf("tournament %s: %q is not a key fingerprint", def.Name, k)
+		}
+		if _, ok := t.standings[k]; ok {
+			return nil, fmt.Errorf("tournament %s: key %s listed twice", def.Name, k)
+		}
+		t.standings[k] = &TournamentStanding{Name: GlobalPseudonym.Get(k)}
+	}
+
+	seed := def.Seed
+	if seed == 0 {
+		seed = rand.Int63()
+	}
+	t.rng = rand.New(rand.NewSource(seed))
+
+	switch def.Format {
+	case TournamentRoundRobin:
+		t.schedule, err = roundRobinSchedule(def.Keys, def.GroupSize, t.rng)
+		if err != nil {
+			return nil, fmt.Errorf("tournament %s: %w", def.Name, err)
+		}
+	case TournamentSwiss:
+		if def.Rounds < 1 {
+			return nil, fmt.Errorf("tournament %s: swiss needs at least one round", def.Name)
+		}
+	case TournamentElimination:
+		t.remaining = append([]string(nil), def.Keys...)
+		t.rng.Shuffle(len(t.remaining), func(i, j int) { t.remaining[i], t.remaining[j] = t.remaining[j], t.remaining[i] })
+	default:
+		return nil, fmt.Errorf("tournament %s: unknown format %s", def.Name, def.Format)
+	}
+
+	return t, nil
+}
+
+// Name returns the name of the tournament.
+func (t *Tournament) Name() string {
+	return t.def.Name
+}
+
+// Join adds a player to its waiting game of the current round. The game starts as soon as all scheduled players have joined.
+// If an error is returned, the player was not added and the caller is responsible for closing it.
+func (t *Tournament) Join(p *Player) error {
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	fingerprint := KeyFingerprint(p.api)
+	for _, tg := range t.games {
+		if tg.Round != t.round || tg.State != tournamentGameWaiting {
+			continue
+		}
+		for _, k := range tg.keys {
+			if k != fingerprint {
+				continue
+			}
+			if _, ok := tg.waiting[k]; ok {
+				return ErrNotScheduled
+			}
+			tg.waiting[k] = p
+			if len(tg.waiting) == len(tg.keys) {
+				t.startGame(tg)
+			}
+			return nil
+		}
+	}
+	return ErrNotScheduled
+}
+
+// Scheduled returns whether the key has a waiting game in the current round which it has not joined yet.
+func (t *Tournament) Scheduled(key string) bool {
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	fingerprint := KeyFingerprint(key)
+	for _, tg := range t.games {
+		if tg.Round != t.round || tg.State != tournamentGameWaiting {
+			continue
+		}
+		for _, k := range tg.keys {
+			if k == fingerprint {
+				_, ok := tg.waiting[k]
+				return !ok
+			}
+		}
+	}
+	return false
+}
+
+// worker schedules new rounds and starts games whose waiting time is over.
+func (t *Tournament) worker() {
+	for {
+		t.l.Lock()
+		if t.finished {
+			t.l.Unlock()
+			return
+		}
+
+		done := true
+		for _, tg := range t.games {
+			if tg.Round != t.round {
+				continue
+			}
+			if tg.State == tournamentGameWaiting && time.Now().Sub(t.roundStart) > t.waitTime {
+				t.startGame(tg)
+			}
+			if tg.State != tournamentGameFinished {
+				done = false
+			}
+		}
+		if done {
+			t.nextRound()
+		}
+		t.l.Unlock()
+		time.Sleep(1 * time.Second)
+	}
+}
+
+// nextRound schedules the games of the next round or finishes the tournament.
+// Caller has to lock t.
+func (t *Tournament) nextRound() {
+	var groups [][]string
+
+	switch t.def.Format {
+	case TournamentRoundRobin:
+		if t.round < len(t.schedule) {
+			groups = t.schedule[t.round]
+		}
+	case TournamentSwiss:
+		if t.round < t.def.Rounds {
+			keys := append([]string(nil), t.def.Keys...)
+			t.rng.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+			sort.SliceStable(keys, func(i, j int) bool { return t.standings[keys[i]].Points > t.standings[keys[j]].Points })
+			groups = splitGroups(keys, t.def.GroupSize)
+		}
+	case TournamentElimination:
+		if len(t.remaining) > 1 {
+			groups = splitGroups(t.remaining, t.def.GroupSize)
+		}
+	}
+
+	if len(groups) == 0 {
+		t.finished = true
+		log.Println("tournament:", t.def.Name, "finished - standings", t.sortedStandings())
+		return
+	}
+
+	t.round++
+	t.roundStart = time.Now()
+	log.Println("tournament:", t.def.Name, "starting round", t.round, "with", len(groups), "games")
+
+	for _, group := range groups {
+		tg := &TournamentGame{Round: t.round, State: tournamentGameWaiting, keys: group, waiting: make(map[string]*Player, len(group))}
+		for _, k := range group {
+			tg.Players = append(tg.Players, t.standings[k].Name)
+		}
+		t.games = append(t.games, tg)
+		if len(group) == 1 {
+			// Bye
+			tg.State = tournamentGameFinished
+			tg.Places = []int{1}
+			t.standings[group[0]].Points += float64(t.def.GroupSize - 1)
+		}
+	}
+}
+
+// startGame starts a waiting game with all players present. Absent players share the last place.
+// If less than two players are present, no game is played and present players share the first place.
+// Caller has to lock t.
+func (t *Tournament) startGame(tg *TournamentGame) {
+	if len(tg.waiting) < 2 {
+		log.Println("tournament:", t.def.Name, "round", t.round, "not enough players present for", tg.keys)
+		places := make(map[string]int, len(tg.keys))
+		for k, p := range tg.waiting {
+			places[k] = 1
+			p.Close()
+		}
+		t.finishGame(tg, places, false)
+		return
+	}
+
+	var seed int64
+	if t.def.Seed != 0 {
+		seed = t.rng.Int63()
+	}
+	g := NewGame(seed, len(tg.waiting), len(tg.waiting))
+	for _, k := range tg.keys {
+		if p, ok := tg.waiting[k]; ok {
+			err := g.AddPlayer(p)
+			if err != nil {
+				log.Println("tournament:", t.def.Name, "adding player:", err)
+			}
+		}
+	}
+	tg.State = tournamentGameRunning
+
+	go func() {
+		ranking, err := g.RunGame()
+		if err != nil {
+			log.Println("tournament:", t.def.Name, "running game:", err)
+		}
+		places := make(map[string]int, len(ranking))
+		for _, r := range g.PlayerPlaces() {
+			places[KeyFingerprint(g.Players[r.Player].api)] = r.Place
+		}
+
+		t.l.Lock()
+		defer t.l.Unlock()
+		t.finishGame(tg, places, g.TeamRanking != nil)
+	}()
+}
+
+// finishGame records the places of a game. Keys not contained in places share the last place.
+// In team games (teams is set), all players of the winning team get a win.
+// Caller has to lock t.
+func (t *Tournament) finishGame(tg *TournamentGame, places map[string]int, teams bool) {
+	tg.State = tournamentGameFinished
+	tg.Places = make([]int, len(tg.keys))
+	for i, k := range tg.keys {
+		p, ok := places[k]
+		if !ok {
+			p = len(places) + 1
+		}
+		tg.Places[i] = p
+	}
+
+	winners := 0
+	for _, p := range tg.Places {
+		if p == 1 {
+			winners++
+		}
+	}
+	for i, k := range tg.keys {
+		s := t.standings[k]
+		s.Games++
+		s.placements += tg.Places[i]
+		s.AveragePlacement = float64(s.placements) / float64(s.Games)
+		if tg.Places[i] == 1 && (winners == 1 || teams) {
+			s.Wins++
+		}
+		for j := range tg.keys {
+			switch {
+			case i == j:
+			case tg.Places[i] < tg.Places[j]:
+				s.Points++
+			case tg.Places[i] == tg.Places[j]:
+				s.Points += 0.5
+			}
+		}
+	}
+
+	if t.def.Format == TournamentElimination {
+		t.advance(tg, len(places) > 0)
+	}
+}
+
+// advance removes all players of a finished game from the remaining players except the best placed one.
+// Ties are broken by points, then randomly. If no player was present, no one advances.
+// Caller has to lock t.
+func (t *Tournament) advance(tg *TournamentGame, present bool) {
+	best := -1
+	if present {
+		candidates := make([]int, 0)
+		for i := range tg.keys {
+			if tg.Places[i] == 1 {
+				candidates = append(candidates, i)
+			}
+		}
+		t.rng.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return t.standings[tg.keys[candidates[i]]].Points > t.standings[tg.keys[candidates[j]]].Points
+		})
+		best = candidates[0]
+	}
+
+	for i, k := range tg.keys {
+		if i == best {
+			continue
+		}
+		t.standings[k].Eliminated = tg.Round
+		for j := range t.remaining {
+			if t.remaining[j] == k {
+				t.remaining = append(t.remaining[:j], t.remaining[j+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// sortedStandings returns the standings ordered by rank.
+// For TournamentElimination, players eliminated later are ranked higher. Otherwise (and for ties) points, then average placement decide.
+// Caller has to lock t.
+func (t *Tournament) sortedStandings() []TournamentStanding {
+	list := make([]TournamentStanding, 0, len(t.standings))
+	for _, s := range t.standings {
+		list = append(list, *s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Eliminated != list[j].Eliminated {
+			if list[i].Eliminated == 0 || list[j].Eliminated == 0 {
+				return list[i].Eliminated == 0
+			}
+			return list[i].Eliminated > list[j].Eliminated
+		}
+		if list[i].Points != list[j].Points {
+			return list[i].Points > list[j].Points
+		}
+		if list[i].AveragePlacement != list[j].AveragePlacement {
+			return list[i].AveragePlacement < list[j].AveragePlacement
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// status returns the public state of the tournament.
+func (t *Tournament) status() tournamentStatus {
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	s := tournamentStatus{Name: t.def.Name, Format: t.def.Format, Round: t.round, Finished: t.finished, Standings: t.sortedStandings(), Games: make([]TournamentGame, len(t.games))}
+	for i := range t.games {
+		s.Games[i] = *t.games[i]
+		s.Games[i].Places = append([]int(nil), t.games[i].Places...)
+	}
+	return s
+}
+
+// roundRobinSchedule returns all combinations of groupSize keys (or a single group if there are less keys), packed into rounds in which each key plays at most once.
+func roundRobinSchedule(keys []string, groupSize int, r *rand.Rand) ([][][]string, error) {
+	if len(keys) <= groupSize {
+		return [][][]string{{append([]string(nil), keys...)}}, nil
+	}
+
+	groups := make([][]string, 0)
+	current := make([]string, 0, groupSize)
+	var combine func(start int) error
+	combine = func(start int) error {
+		if len(current) == groupSize {
+			if len(groups) == TournamentMaxGames {
+				return fmt.Errorf("more than %d games", TournamentMaxGames)
+			}
+			groups = append(groups, append([]string(nil), current...))
+			return nil
+		}
+		for i := start; i <= len(keys)-(groupSize-len(current)); i++ {
+			current = append(current, keys[i])
+			if err := combine(i + 1); err != nil {
+				return err
+			}
+			current = current[:len(current)-1]
+		}
+		return nil
+	}
+	if err := combine(0); err != nil {
+		return nil, err
+	}
+	r.Shuffle(len(groups), func(i, j int) { groups[i], groups[j] = groups[j], groups[i] })
+
+	rounds := make([][][]string, 0)
+	for len(groups) > 0 {
+		used := make(map[string]bool, len(keys))
+		round := make([][]string, 0)
+		rest := groups[:0]
+		for _, g := range groups {
+			free := true
+			for _, k := range g {
+				if used[k] {
+					free = false
+					break
+				}
+			}
+			if !free {
+				rest = append(rest, g)
+				continue
+			}
+			for _, k := range g {
+				used[k] = true
+			}
+			round = append(round, g)
+		}
+		groups = rest
+		rounds = append(rounds, round)
+	}
+	return rounds, nil
+}
+
+// splitGroups splits keys in order into as few groups of at most groupSize keys as possible. The sizes of the groups differ by at most one.
+func splitGroups(keys []string, groupSize int) [][]string {
+	n := (len(keys) + groupSize - 1) / groupSize
+	groups := make([][]string, 0, n)
+	start := 0
+	for i := 0; i < n; i++ {
+		size := len(keys) / n
+		if i < len(keys)%n {
+			size++
+		}
+		groups = append(groups, append([]string(nil), keys[start:start+size]...))
+		start += size
+	}
+	return groups
+}
+
+// tournamentEndpoint serves the standings of the tournament as HTML.
+func tournamentEndpoint(rw http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	err := tournamentTemplate.Execute(&buf, tournament.status())
+	if err != nil {
+		log.Println("tournament:", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		rw.Write([]byte(err.Error()))
+		return
+	}
+	rw.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	rw.Write(buf.Bytes())
+}
+
+// tournamentJSONEndpoint serves the standings of the tournament as JSON.
+func tournamentJSONEndpoint(rw http.ResponseWriter, r *http.Request) {
+	b, err := json.Marshal(tournament.status())
+	if err != nil {
+		log.Println("tournament:", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		rw.Write([]byte(err.Error()))
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Access-Control-Allow-Origin", "*")
+	rw.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	rw.Write(b)
+}
@@ -0,0 +1,311 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fingerprints returns the fingerprints of the keys.
+func fingerprints(keys ...string) []string {
+	f := make([]string, len(keys))
+	for i := range keys {
+		f[i] = KeyFingerprint(keys[i])
+	}
+	return f
+}
+
+// startRound schedules the next round of a tournament.
+func startRound(t *Tournament) {
+	t.l.Lock()
+	defer t.l.Unlock()
+	t.nextRound()
+}
+
+// aiPlayer returns a player using the API key which is controlled by the named AI.
+func aiPlayer(t *testing.T, key, ai string) *Player {
+	t.Helper()
+	ais, err := GetNamedAI([]string{ai}, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Player{api: key, underlyingAI: ais[0].AI, Input: make(chan string, 5)}
+	p.underlyingAI.GetChannel(p.Input)
+	return p
+}
+
+func TestNewTournament(t *testing.T) {
+	valid := TournamentDefinition{Name: "test", Format: TournamentSwiss, Keys: fingerprints("a", "b", "c"), GroupSize: 2, Rounds: 2, Wait: "1m"}
+	tests := []struct {
+		name   string
+		change func(d *TournamentDefinition)
+		err    string // empty if the definition is valid
+	}{
+		{"valid", func(d *TournamentDefinition) {}, ""},
+		{"round robin", func(d *TournamentDefinition) { d.Format = TournamentRoundRobin }, ""},
+		{"elimination", func(d *TournamentDefinition) { d.Format = TournamentElimination }, ""},
+		{"plain key", func(d *TournamentDefinition) { d.Keys = []string{KeyFingerprint("a"), "b"} }, "not a key fingerprint"},
+		{"key twice", func(d *TournamentDefinition) { d.Keys = fingerprints("a", "b", "a") }, "listed twice"},
+		{"single key", func(d *TournamentDefinition) { d.Keys = fingerprints("a") }, "at least 2 keys"},
+		{"group size", func(d *TournamentDefinition) { d.GroupSize = 1 }, "group size"},
+		{"invalid wait", func(d *TournamentDefinition) { d.Wait = "soon" }, "duration"},
+		{"negative wait", func(d *TournamentDefinition) { d.Wait = "-1m" }, "waiting time"},
+		{"no rounds", func(d *TournamentDefinition) { d.Rounds = 0 }, "at least one round"},
+		{"unknown format", func(d *TournamentDefinition) { d.Format = "knockout" }, "unknown format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def := valid
+			def.Keys = append([]string(nil), valid.Keys...)
+			tt.change(&def)
+			_, err := NewTournament(def)
+			if tt.err == "" {
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRoundRobinSchedule(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "e"}
+	rounds, err := roundRobinSchedule(keys, 3, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	games := make(map[string]int)
+	for i, round := range rounds {
+		used := make(map[string]bool)
+		for _, g := range round {
+			if len(g) != 3 {
+				t.Errorf("round %d: group %v has wrong size", i, g)
+			}
+			for _, k := range g {
+				if used[k] {
+					t.Errorf("round %d: key %s plays twice", i, k)
+				}
+				used[k] = true
+			}
+			games[strings.Join(g, "")]++
+		}
+	}
+	// 5 choose 3
+	if len(games) != 10 {
+		t.Errorf("got %d different games, want 10", len(games))
+	}
+	for g, n := range games {
+		if n != 1 {
+			t.Errorf("game %s scheduled %d times", g, n)
+		}
+	}
+
+	rounds, err = roundRobinSchedule([]string{"a", "b"}, 3, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rounds, [][][]string{{{"a", "b"}}}) {
+		t.Errorf("less keys than group size: got %v", rounds)
+	}
+}
+
+func TestSplitGroups(t *testing.T) {
+	tests := []struct {
+		keys      []string
+		groupSize int
+		want      [][]string
+	}{
+		{[]string{"a", "b", "c", "d"}, 2, [][]string{{"a", "b"}, {"c", "d"}}},
+		{[]string{"a", "b", "c", "d", "e"}, 2, [][]string{{"a", "b"}, {"c", "d"}, {"e"}}},
+		{[]string{"a", "b", "c", "d", "e"}, 3, [][]string{{"a", "b", "c"}, {"d", "e"}}},
+		{[]string{"a", "b", "c", "d", "e", "f", "g"}, 4, [][]string{{"a", "b", "c", "d"}, {"e", "f", "g"}}},
+		{[]string{"a", "b"}, 6, [][]string{{"a", "b"}}},
+	}
+	for _, tt := range tests {
+		got := splitGroups(tt.keys, tt.groupSize)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitGroups(%v, %d): got %v, want %v", tt.keys, tt.groupSize, got, tt.want)
+		}
+	}
+}
+
+func TestTournamentFinishGame(t *testing.T) {
+	keys := fingerprints("a", "b", "c")
+	tests := []struct {
+		name   string
+		places map[string]int
+		teams  bool
+		points []float64
+		wins   []int
+	}{
+		{"ranking", map[string]int{keys[0]: 1, keys[1]: 2, keys[2]: 3}, false, []float64{2, 1, 0}, []int{1, 0, 0}},
+		{"draw", map[string]int{keys[0]: 1, keys[1]: 1, keys[2]: 3}, false, []float64{1.5, 1.5, 0}, []int{0, 0, 0}},
+		{"team", map[string]int{keys[0]: 1, keys[1]: 1, keys[2]: 3}, true, []float64{1.5, 1.5, 0}, []int{1, 1, 0}},
+		{"absent", map[string]int{keys[1]: 1}, false, []float64{0.5, 2, 0.5}, []int{0, 1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tour, err := NewTournament(TournamentDefinition{Name: "test", Format: TournamentRoundRobin, Keys: keys, GroupSize: 3, Wait: "1m"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			startRound(tour)
+			if len(tour.games) != 1 {
+				t.Fatalf("got %d games, want 1", len(tour.games))
+			}
+			tg := tour.games[0]
+			tour.finishGame(tg, tt.places, tt.teams)
+
+			if tg.State != tournamentGameFinished {
+				t.Errorf("got state %s", tg.State)
+			}
+			for i, k := range keys {
+				s := tour.standings[k]
+				if s.Games != 1 || s.Points != tt.points[i] || s.Wins != tt.wins[i] || s.AveragePlacement != float64(tg.Places[i]) {
+					t.Errorf("key %d: got %+v, want %v points and %d wins", i, *s, tt.points[i], tt.wins[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTournamentElimination(t *testing.T) {
+	keys := fingerprints("a", "b", "c", "d")
+	tour, err := NewTournament(TournamentDefinition{Name: "test", Format: TournamentElimination, Keys: keys, GroupSize: 2, Wait: "1m", Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for round := 1; round <= 2; round++ {
+		startRound(tour)
+		if tour.round != round {
+			t.Fatalf("got round %d, want %d", tour.round, round)
+		}
+		for _, tg := range tour.games {
+			if tg.Round != round {
+				continue
+			}
+			tour.finishGame(tg, map[string]int{tg.keys[0]: 1, tg.keys[1]: 2}, false)
+			if tour.standings[tg.keys[0]].Eliminated != 0 || tour.standings[tg.keys[1]].Eliminated != round {
+				t.Errorf("round %d: loser not eliminated", round)
+			}
+		}
+	}
+	if len(tour.remaining) != 1 {
+		t.Fatalf("got %d remaining keys, want 1", len(tour.remaining))
+	}
+
+	startRound(tour)
+	if !tour.finished {
+		t.Fatal("tournament not finished")
+	}
+	standings := tour.sortedStandings()
+	if standings[0].Name != tour.standings[tour.remaining[0]].Name || standings[0].Eliminated != 0 || standings[1].Eliminated != 2 || standings[3].Eliminated != 1 {
+		t.Errorf("got standings %+v", standings)
+	}
+}
+
+func TestTournamentJoin(t *testing.T) {
+	useRatings(t)
+	tour, err := NewTournament(TournamentDefinition{Name: "test", Format: TournamentRoundRobin, Keys: fingerprints("a", "b"), GroupSize: 2, Wait: "1m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tour.Scheduled("a") {
+		t.Error("key scheduled before the first round")
+	}
+	startRound(tour)
+
+	if !tour.Scheduled("a") || !tour.Scheduled("b") || tour.Scheduled("c") {
+		t.Fatal("wrong keys scheduled")
+	}
+	if err := tour.Join(&Player{api: "c"}); err != ErrNotScheduled {
+		t.Errorf("unscheduled key: got error %v", err)
+	}
+	if err := tour.Join(&Player{api: KeyFingerprint("a")}); err != ErrNotScheduled {
+		t.Errorf("fingerprint as key: got error %v", err)
+	}
+
+	if err := tour.Join(aiPlayer(t, "a", "SnailAI")); err != nil {
+		t.Fatal(err)
+	}
+	if tour.Scheduled("a") {
+		t.Error("joined key is still scheduled")
+	}
+	if err := tour.Join(aiPlayer(t, "a", "SnailAI")); err != ErrNotScheduled {
+		t.Errorf("second join: got error %v", err)
+	}
+	if err := tour.Join(aiPlayer(t, "b", "BadRandomAI")); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "end of the game", func() bool { return tour.status().Games[0].State == tournamentGameFinished })
+	s := tour.status()
+	// Both players were present, so the places must differ
+	places := s.Games[0].Places
+	if len(places) != 2 || places[0]+places[1] != 3 {
+		t.Errorf("got places %v", places)
+	}
+	for _, st := range s.Standings {
+		if st.Games != 1 {
+			t.Errorf("standing %+v does not contain the game", st)
+		}
+	}
+}
+
+func TestTournamentEndpoint(t *testing.T) {
+	usePseudonyms(t, map[string]string{KeyFingerprint("a"): "Team-A", KeyFingerprint("b"): "Team-B"})
+	old := tournament
+	defer func() { tournament = old }()
+	var err error
+	tournament, err = NewTournament(TournamentDefinition{Name: "league", Format: TournamentSwiss, Keys: fingerprints("a", "b"), GroupSize: 2, Rounds: 1, Wait: "1m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	startRound(tournament)
+
+	rw := httptest.NewRecorder()
+	tournamentJSONEndpoint(rw, httptest.NewRequest("GET", "/spe_ed_tournament.json", nil))
+	var s tournamentStatus
+	err = json.Unmarshal(rw.Body.Bytes(), &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "league" || s.Round != 1 || len(s.Games) != 1 || len(s.Standings) != 2 {
+		t.Errorf("got status %+v", s)
+	}
+	if strings.Contains(rw.Body.String(), KeyFingerprint("a")) {
+		t.Error("status contains key fingerprints")
+	}
+
+	rw = httptest.NewRecorder()
+	tournamentEndpoint(rw, httptest.NewRequest("GET", "/spe_ed_tournament", nil))
+	for _, want := range []string{"league", "Team-A", "Team-B", "waiting"} {
+		if !strings.Contains(rw.Body.String(), want) {
+			t.Errorf("html does not contain %q", want)
+		}
+	}
+}
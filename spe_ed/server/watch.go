@@ -0,0 +1,269 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WatchQueueSize is the number of states which can wait for their broadcast delay per game.
+// If the queue is full, new states are dropped for spectators.
+const WatchQueueSize = 1024
+
+// WatchViewerQueueSize is the number of states which can wait to be sent to a single spectator.
+// Spectators which fall further behind are disconnected so they can not stall the other spectators.
+const WatchViewerQueueSize = 16
+
+var (
+	watchEnabled = false
+	watchDelay   = 10 * time.Second
+
+	watchLock  sync.Mutex
+	watchGames = make(map[string]*WatchedGame)
+)
+
+// WatchInfo contains the public information about a running game, as listed by the watch endpoint.
+type WatchInfo struct {
+	ID      string    `json:"id"`
+	Start   time.Time `json:"start"`
+	Players int       `json:"players"`
+	Width   int       `json:"width"`
+	Height  int       `json:"height"`
+}
+
+type watchState struct {
+	t time.Time
+	b []byte
+}
+
+// watchViewer is a single spectator. All states are written by its own goroutine (see writer).
+type watchViewer struct {
+	c     *websocket.Conn
+	send  chan []byte
+	close []byte // close message sent after send was closed
+}
+
+// WatchedGame distributes the states of a running game to spectators.
+// All states are delayed by watchDelay so spectators can not feed live information to players.
+type WatchedGame struct {
+	info WatchInfo
+
+	l        sync.Mutex
+	closed   bool
+	finished bool // whether the last state was broadcasted and all spectators were disconnected
+	queue    chan watchState
+	last     []byte
+	viewers  map[*websocket.Conn]*watchViewer
+}
+
+// NewWatchedGame registers a new game for spectators.
+// Close must be called after the game has finished.
+func NewWatchedGame(info WatchInfo) *WatchedGame {
+	w := &WatchedGame{
+		info:    info,
+		queue:   make(chan watchState, WatchQueueSize),
+		viewers: make(map[*websocket.Conn]*watchViewer),
+	}
+
+	watchLock.Lock()
+	watchGames[info.ID] = w
+	watchLock.Unlock()
+
+	go w.worker()
+	return w
+}
+
+// Publish sends a state (JSON encoded game) to all spectators after the broadcast delay.
+// It never blocks.
+func (w *WatchedGame) Publish(b []byte) {
+	w.l.Lock()
+	defer w.l.Unlock()
+
+	if w.closed {
+		return
+	}
+
+	select {
+	case w.queue <- watchState{t: time.Now(), b: b}:
+	default:
+		log.Println("watch:", w.info.ID, "queue full, dropping state")
+	}
+}
+
+// Close marks the game as finished. Spectators are disconnected after the last state was sent.
+// Successive calls have no effect.
+func (w *WatchedGame) Close() {
+	w.l.Lock()
+	defer w.l.Unlock()
+
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+}
+
+// addViewer adds a spectator and sends the last broadcasted state to it.
+// If the game has already finished, the connection is closed instead and false is returned.
+func (w *WatchedGame) addViewer(c *websocket.Conn) bool {
+	w.l.Lock()
+	defer w.l.Unlock()
+
+	if w.finished {
+		c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "game finished"), time.Now().Add(time.Second))
+		c.Close()
+		return false
+	}
+
+	v := &watchViewer{c: c, send: make(chan []byte, WatchViewerQueueSize)}
+	w.viewers[c] = v
+	if w.last != nil {
+		v.send <- w.last
+	}
+	go v.writer()
+	return true
+}
+
+// removeViewer removes a spectator and closes its connection.
+func (w *WatchedGame) removeViewer(c *websocket.Conn) {
+	w.l.Lock()
+	defer w.l.Unlock()
+
+	if v, ok := w.viewers[c]; ok {
+		w.drop(v, websocket.CloseNormalClosure, "")
+	}
+}
+
+// drop removes a spectator. Its connection is closed after all queued states are written.
+// Caller has to lock w.
+func (w *WatchedGame) drop(v *watchViewer, code int, text string) {
+	delete(w.viewers, v.c)
+	v.close = websocket.FormatCloseMessage(code, text)
+	close(v.send)
+}
+
+// writer sends all states of a spectator until its queue is closed.
+func (v *watchViewer) writer() {
+	failed := false
+	for b := range v.send {
+		if failed {
+			continue
+		}
+		v.c.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		err := v.c.WriteMessage(websocket.TextMessage, b)
+		if err != nil {
+			// The reading goroutine notices the closed connection and removes the spectator
+			failed = true
+			v.c.Close()
+		}
+	}
+	if !failed {
+		v.c.WriteControl(websocket.CloseMessage, v.close, time.Now().Add(time.Second))
+	}
+	v.c.Close()
+}
+
+func (w *WatchedGame) worker() {
+	for s := range w.queue {
+		time.Sleep(time.Until(s.t.Add(watchDelay)))
+
+		w.l.Lock()
+		w.last = s.b
+		for _, v := range w.viewers {
+			select {
+			case v.send <- s.b:
+			default:
+				log.Println("watch:", w.info.ID, "spectator too slow, disconnecting")
+				w.drop(v, websocket.CloseTryAgainLater, "too slow")
+				// Do not wait until the queued states are written
+				v.c.Close()
+			}
+		}
+		w.l.Unlock()
+	}
+
+	watchLock.Lock()
+	delete(watchGames, w.info.ID)
+	watchLock.Unlock()
+
+	w.l.Lock()
+	w.finished = true
+	for _, v := range w.viewers {
+		w.drop(v, websocket.CloseNormalClosure, "game finished")
+	}
+	w.l.Unlock()
+}
+
+// watchEndpoint lists all running games as JSON or, if the parameter "game" is set, streams the states of that game to a websocket.
+func watchEndpoint(rw http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("game")
+
+	if id == "" {
+		watchLock.Lock()
+		list := make([]WatchInfo, 0, len(watchGames))
+		for k := range watchGames {
+			list = append(list, watchGames[k].info)
+		}
+		watchLock.Unlock()
+		sort.Slice(list, func(i, j int) bool { return list[i].Start.Before(list[j].Start) })
+
+		b, err := json.Marshal(list)
+		if err != nil {
+			log.Println("watch:", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Header().Set("Access-Control-Allow-Origin", "*")
+		rw.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+		rw.Write(b)
+		return
+	}
+
+	watchLock.Lock()
+	w, ok := watchGames[id]
+	watchLock.Unlock()
+	if !ok {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(rw, r, nil)
+	if err != nil {
+		log.Println("watch upgrade:", err)
+		return
+	}
+
+	if !w.addViewer(conn) {
+		return
+	}
+
+	// Spectators are read-only - discard everything, but notice closed connections
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				w.removeViewer(conn)
+				return
+			}
+		}
+	}()
+}
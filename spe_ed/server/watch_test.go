@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2020,2021 Philipp Naumann, Marcus Soll
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// watchServer starts a test server for the watch endpoint without broadcast delay.
+func watchServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	delay := watchDelay
+	watchDelay = 0
+	s := httptest.NewServer(http.HandlerFunc(watchEndpoint))
+	t.Cleanup(func() {
+		s.Close()
+		watchDelay = delay
+	})
+	return s
+}
+
+// dialWatch connects a spectator to a game.
+func dialWatch(t *testing.T, s *httptest.Server, id string) *websocket.Conn {
+	t.Helper()
+	c, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"?game="+id, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// readUntilClose reads all states until the connection is closed and returns them with the close error.
+func readUntilClose(c *websocket.Conn) ([]string, error) {
+	states := make([]string, 0)
+	for {
+		c.SetReadDeadline(time.Now().Add(10 * time.Second))
+		_, b, err := c.ReadMessage()
+		if err != nil {
+			return states, err
+		}
+		states = append(states, string(b))
+	}
+}
+
+func TestWatchBroadcast(t *testing.T) {
+	s := watchServer(t)
+	w := NewWatchedGame(WatchInfo{ID: "broadcast"})
+	c := dialWatch(t, s, "broadcast")
+
+	for i := 0; i < 3; i++ {
+		w.Publish([]byte(fmt.Sprint(i)))
+	}
+	w.Close()
+
+	states, err := readUntilClose(c)
+	if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("got error %v, want normal closure", err)
+	}
+	if strings.Join(states, ",") != "0,1,2" {
+		t.Errorf("got states %v", states)
+	}
+}
+
+func TestWatchAfterFinish(t *testing.T) {
+	s := watchServer(t)
+	w := NewWatchedGame(WatchInfo{ID: "finished"})
+	w.Publish([]byte("last"))
+	w.Close()
+
+	// The game is removed from the list when the worker has finished
+	for i := 0; ; i++ {
+		watchLock.Lock()
+		_, ok := watchGames["finished"]
+		watchLock.Unlock()
+		if !ok {
+			break
+		}
+		if i == 100 {
+			t.Fatal("game was not removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Simulate a spectator which was looked up before the game was removed
+	watchLock.Lock()
+	watchGames["finished"] = w
+	watchLock.Unlock()
+	c := dialWatch(t, s, "finished")
+	watchLock.Lock()
+	delete(watchGames, "finished")
+	watchLock.Unlock()
+
+	states, err := readUntilClose(c)
+	if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("got error %v, want normal closure", err)
+	}
+	if len(states) != 0 {
+		t.Errorf("got states %v after the game finished", states)
+	}
+}
+
+func TestWatchSlowViewer(t *testing.T) {
+	s := watchServer(t)
+	w := NewWatchedGame(WatchInfo{ID: "slow"})
+	slow := dialWatch(t, s, "slow")
+	fast := dialWatch(t, s, "slow")
+
+	// Large states fill the network buffers of the spectator which never reads
+	const states = 64
+	state := bytes.Repeat([]byte("x"), 1<<20)
+	start := time.Now()
+	for i := 0; i < states; i++ {
+		w.Publish(state)
+		fast.SetReadDeadline(time.Now().Add(10 * time.Second))
+		_, _, err := fast.ReadMessage()
+		if err != nil {
+			t.Fatalf("state %d: %v", i, err)
+		}
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("broadcast took %v, slow spectator stalled the game", d)
+	}
+	w.Close()
+
+	_, err := readUntilClose(fast)
+	if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("fast spectator: got error %v, want normal closure", err)
+	}
+	received, err := readUntilClose(slow)
+	if err == nil || len(received) == states {
+		t.Errorf("slow spectator was not disconnected, got %d states", len(received))
+	}
+}